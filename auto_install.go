@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Auto install modes, set with `auto_install:` in dotfile-config.yaml or --auto-install
+const (
+	// AutoInstallNever never installs software during a sync
+	AutoInstallNever = "never"
+
+	// AutoInstallNew installs software entries added since the last sync
+	AutoInstallNew = "new"
+
+	// AutoInstallAlways installs every software entry that is not installed
+	AutoInstallAlways = "always"
+)
+
+// Confirmation policies for installs triggered by a sync, set with --install-confirmation
+const (
+	// ConfirmAuto installs without asking
+	ConfirmAuto = "auto"
+
+	// ConfirmPrompt asks on the terminal and skips the install when no terminal is attached
+	ConfirmPrompt = "prompt"
+)
+
+// InstallPolicy controls software installation during syncs
+type InstallPolicy struct {
+	AutoInstall  string // never, new or always; empty defers to dotfile-config.yaml
+	Confirmation string // auto or prompt
+}
+
+// DefaultInstallPolicy defers to dotfile-config.yaml and asks before installing
+var DefaultInstallPolicy = InstallPolicy{Confirmation: ConfirmPrompt}
+
+// Validate returns an error if the policy contains unknown values
+func (p InstallPolicy) Validate() error {
+	if err := validateAutoInstall(p.AutoInstall); err != nil {
+		return err
+	}
+
+	switch p.Confirmation {
+	case ConfirmAuto, ConfirmPrompt:
+		return nil
+	default:
+		return fmt.Errorf("unknown install confirmation policy %q (available: %s, %s)", p.Confirmation, ConfirmAuto, ConfirmPrompt)
+	}
+}
+
+// validateAutoInstall returns an error for unknown auto install modes. Empty is accepted.
+func validateAutoInstall(mode string) error {
+	switch mode {
+	case "", AutoInstallNever, AutoInstallNew, AutoInstallAlways:
+		return nil
+	default:
+		return fmt.Errorf("unknown auto_install mode %q (available: %s, %s, %s)", mode, AutoInstallNever, AutoInstallNew, AutoInstallAlways)
+	}
+}
+
+// AutoInstall installs software as part of a sync according to the install policy.
+// With `new`, only entries that were not in the config at the last sync are installed;
+// with `always`, every entry is considered. Installed checks still skip software that is present.
+// Installer output is passed to output line by line. Failed installs do not fail the
+// sync: they stay pending and are retried on the next sync.
+// The software of the config is remembered on the first sync and on every sync with
+// installation disabled, so `new` never installs entries that were there before.
+func AutoInstall(config *Configurations, enhancedConfig *EnhancedConfig, output func(line string)) error {
+	mode := config.Install.AutoInstall
+	if mode == "" {
+		mode = enhancedConfig.AutoInstall
+	}
+	if err := validateAutoInstall(mode); err != nil {
+		return err
+	}
+
+	state, err := LoadAgentState(config.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	disabled := mode == "" || mode == AutoInstallNever
+	if state.KnownSoftware == nil || disabled {
+		state.KnownSoftware = append([]string{}, enhancedConfig.GetSoftwareList()...)
+		if err := state.Save(config.ConfigPath); err != nil {
+			return err
+		}
+	}
+
+	if disabled {
+		output("Automatic installation is disabled")
+		return nil
+	}
+
+	var candidates []string
+	for _, software := range enhancedConfig.GetSoftwareList() {
+		if mode == AutoInstallAlways || !slices.Contains(state.KnownSoftware, software) {
+			candidates = append(candidates, software)
+		}
+	}
+
+	if len(candidates) == 0 {
+		output("No new software to install")
+		return nil
+	}
+
+	writer := newLineWriter(output)
+	installer := NewInstaller(enhancedConfig, PrintInstallEvents(writer))
+	installer.Executor.LogDir = filepath.Join(config.ConfigPath, installLogDir)
+	if _, _, err := installer.Plan(candidates...); err != nil {
+		return err
+	}
+
+	if !confirmInstall(config.Install.Confirmation, candidates) {
+		output("Installation of " + strings.Join(candidates, ", ") + " was not confirmed, skipping")
+		return nil
+	}
+
+	report, err := installer.Install(candidates...)
+	if err != nil {
+		return err
+	}
+	PrintInstallReport(writer, report)
+	writer.Flush()
+
+	notInstalled := report.NotInstalled()
+
+	// Remember everything that is installed now; failures are retried next time
+	state.KnownSoftware = []string{}
+	for _, software := range enhancedConfig.GetSoftwareList() {
+		if !slices.Contains(notInstalled, software) {
+			state.KnownSoftware = append(state.KnownSoftware, software)
+		}
+	}
+
+	return state.Save(config.ConfigPath)
+}
+
+// confirmInstall applies the confirmation policy before installing software
+func confirmInstall(policy string, software []string) bool {
+	if policy == ConfirmAuto {
+		return true
+	}
+
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false // no terminal to ask on
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("\nInstall %s? (y/n): ", strings.Join(software, ", "))
+	response, _ := reader.ReadString('\n')
+	response = strings.TrimSpace(strings.ToLower(response))
+
+	return response == "y" || response == "yes"
+}
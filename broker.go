@@ -12,10 +12,12 @@ import (
 
 // BrokerNotifier handles communication with an external broker service for monitoring and notifications.
 // It sends sync events and status updates to a centralized broker for multi-machine coordination.
+// Failed notifications are retried with the agent's retry policy.
 type BrokerNotifier struct {
-	machine   string // Unique machine identifier from DOTFILE_MACHINE_ID env var
-	brokerUrl string // Broker service URL from DOTFILE_BROKER_URL env var
-	git       *Git   // Git instance for accessing repository information
+	machine   string         // Unique machine identifier from DOTFILE_MACHINE_ID env var
+	brokerUrl string         // Broker service URL from DOTFILE_BROKER_URL env var
+	git       *Git           // Git instance for accessing repository information
+	events    chan SyncEvent // Sync events waiting to be delivered, in order
 }
 
 // SyncStatus represents the synchronization state sent to the broker
@@ -31,6 +33,9 @@ type Machine struct {
 	SyncStatus SyncStatus `json:"sync_details"` // Current sync status of the machine
 }
 
+// brokerEventQueueSize is the number of sync events buffered while the broker is unreachable
+const brokerEventQueueSize = 128
+
 // NewBrokerNotifier creates a new BrokerNotifier instance.
 // It reads configuration from environment variables DOTFILE_MACHINE_ID and DOTFILE_BROKER_URL.
 // If either is missing, the broker functionality is disabled but the agent continues to work.
@@ -43,31 +48,34 @@ func NewBrokerNotifier(git *Git) *BrokerNotifier {
 		Infoln("Broker notifier is enabled")
 	}
 
-	return &BrokerNotifier{machine, brokerUrl, git}
+	b := &BrokerNotifier{machine, brokerUrl, git, nil}
+	if b.enabled() {
+		b.events = make(chan SyncEvent, brokerEventQueueSize)
+		go b.deliverEvents()
+	}
+
+	return b
 }
 
-// SyncEvent sends a sync progress event to the broker service.
+// SyncEvent queues a sync progress event for the broker service.
 // This allows real-time monitoring of sync operations across multiple machines.
+// Events are delivered in order by a background worker, so retries never block a sync.
 // Only sends if both machine ID and broker URL are configured.
 func (b BrokerNotifier) SyncEvent(payload SyncEvent) {
-	if b.machine != "" && b.brokerUrl != "" {
-		v, _ := json.Marshal(payload)
-		request, err := http.NewRequest("POST", b.brokerUrl+"/machines/"+b.machine+"/sync-event", bytes.NewBuffer(v))
-		if err != nil {
-			Error("Failed to send notification to broker:", err.Error())
-			return
-		}
-		request.Header.Set("Content-Type", "application/json")
-		response, err := http.DefaultClient.Do(request)
-		if err != nil {
-			Error("Failed to send notification to broker:", err.Error())
-			return
+	if b.enabled() {
+		select {
+		case b.events <- payload:
+		default:
+			Error("Failed to send notification to broker: event queue is full")
 		}
+	}
+}
 
-		if response.StatusCode != http.StatusOK {
-			body, _ := io.ReadAll(response.Body)
-			Error("Failed to send notification to broker:", string(body))
-			return
+// deliverEvents posts queued sync events to the broker one at a time
+func (b BrokerNotifier) deliverEvents() {
+	for event := range b.events {
+		if err := b.post("/machines/"+b.machine+"/sync-event", event, http.StatusOK); err != nil {
+			Error("Failed to send notification to broker:", err.Error())
 		}
 	}
 }
@@ -76,20 +84,10 @@ func (b BrokerNotifier) SyncEvent(payload SyncEvent) {
 // This updates the broker with the latest local/remote commit information.
 // Runs asynchronously in a goroutine to avoid blocking the sync process.
 func (b BrokerNotifier) SyncStatus(payload any) {
-	if b.machine != "" && b.brokerUrl != "" {
+	if b.enabled() {
 		go func() {
-			v, _ := json.Marshal(payload)
-			request, _ := http.NewRequest("POST", b.brokerUrl+"/machines/"+b.machine+"/sync-status", bytes.NewBuffer(v))
-			request.Header.Set("Content-Type", "application/json")
-			response, err := http.DefaultClient.Do(request)
-			if err != nil {
-				fmt.Println(err)
+			if err := b.post("/machines/"+b.machine+"/sync-status", payload, http.StatusOK); err != nil {
 				Error("Failed to send notification to broker:", err.Error())
-				return
-			}
-
-			if response.StatusCode != 200 {
-				Error("Failed to send notification to broker:", response.Status)
 			}
 		}()
 	}
@@ -100,7 +98,7 @@ func (b BrokerNotifier) SyncStatus(payload any) {
 // This is called on startup to announce the machine's presence to the broker.
 // Runs asynchronously in a goroutine.
 func (b BrokerNotifier) RegisterStream() {
-	if b.machine != "" && b.brokerUrl != "" {
+	if b.enabled() {
 		go func() {
 
 			localCommit, err := b.git.LocalCommit()
@@ -115,22 +113,41 @@ func (b BrokerNotifier) RegisterStream() {
 				},
 			}
 
-			body, err := json.Marshal(machine)
-			if err != nil {
-				Error("Failed to marshal machine:", err.Error())
-				return
-			}
-
-			res, err := http.Post(b.brokerUrl+"/machines", "application/json", strings.NewReader(string(body)))
-			if err != nil {
+			if err := b.post("/machines", machine, http.StatusNoContent); err != nil {
 				Error("Unable to send broker notifier:", err.Error())
-				return
-			}
-
-			if res.StatusCode != http.StatusNoContent {
-				Error("Unable to send broker notifier:", res.Status)
-				return
 			}
 		}()
 	}
 }
+
+// enabled reports whether both machine ID and broker URL are configured
+func (b BrokerNotifier) enabled() bool {
+	return b.machine != "" && b.brokerUrl != ""
+}
+
+// post sends a JSON payload to a broker endpoint, retrying transient failures
+func (b BrokerNotifier) post(endpoint string, payload any, expectedStatus int) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return b.git.config.Retry.Do(func() error {
+		response, err := http.Post(b.brokerUrl+endpoint, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != expectedStatus {
+			message, _ := io.ReadAll(response.Body)
+			err := fmt.Errorf("%s %s", response.Status, strings.TrimSpace(string(message)))
+			if isPermanentStatus(response.StatusCode) {
+				return Permanent(err)
+			}
+			return err
+		}
+
+		return nil
+	}, logRetry("Broker notification"))
+}
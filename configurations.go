@@ -6,37 +6,71 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
 )
 
 // Configurations holds all configuration settings for the dotfile agent
 type Configurations struct {
-	DotfilePath     string // Local directory where dotfiles repository is cloned
-	WebHook         string // Git webhook URL for receiving push notifications
-	Port            string // HTTP port for the agent server
-	GithubToken     string // GitHub personal access token for API authentication
-	ConfigPath      string // Directory for agent configuration and database files
-	GitUrl          string // Full Git repository URL (e.g., https://github.com/user/repo.git)
-	GitRepository   string // Repository name extracted from GitUrl
-	RepositoryOwner string // Repository owner/organization extracted from GitUrl
-	GitApiBaseUrl   string // Base URL for Git API (default: https://api.github.com)
+	DotfilePath     string        // Local directory where dotfiles repository is cloned
+	WebHook         string        // Git webhook URL for receiving push notifications
+	Port            string        // HTTP port for the agent server
+	Token           string        // API token of the Git hosting provider, also used for HTTPS clones (optional)
+	ConfigPath      string        // Directory for agent configuration and database files
+	GitUrl          string        // Full Git repository URL (e.g., https://github.com/user/repo.git or git@github.com:user/repo.git)
+	SSHKey          string        // Private key file for SSH URLs, empty to use the SSH agent
+	GitRepository   string        // Repository name extracted from GitUrl
+	RepositoryOwner string        // Repository owner/organization extracted from GitUrl, group/subgroup on GitLab
+	Provider        string        // Git hosting provider: github, gitlab, gitea, bitbucket or git (ls-remote)
+	GitApiBaseUrl   string        // Base URL for Git API (default: derived from the provider and host)
+	Ref             GitRef        // Tracked branch, tag, pinned commit or tag pattern (default: main)
+	Strategy        string        // Sync strategy: auto, enhanced, legacy or stow
+	Retry           RetryPolicy   // Retry policy for git and HTTP operations
+	Install         InstallPolicy // Software installation during syncs
 }
 
 // InitializeConfigurations creates and validates the agent configuration.
 // It reads from environment variables, command-line flags, and sets up necessary directories.
-// Returns an error if required configuration (like GITHUB_TOKEN) is missing.
+// Returns an error if the configuration is invalid.
 func InitializeConfigurations(
 	dotfilePath string,
 	webHook string,
 	port string,
 	configPath string,
 	gitUrl string,
-	githubApiBaseUrl string) (*Configurations, error) {
+	sshKey string,
+	provider string,
+	gitApiBaseUrl string,
+	ref string,
+	strategy string,
+	retry RetryPolicy,
+	install InstallPolicy) (*Configurations, error) {
 
-	// GitHub token is required for API access
-	gitToken, ok := os.LookupEnv("GITHUB_TOKEN")
-	if !ok {
-		return nil, errors.New("no GITHUB_TOKEN environment variable found")
+	// Default to tracking the main branch
+	if ref == "" {
+		ref = DefaultRef
+	}
+
+	if err := GitRef(ref).Validate(); err != nil {
+		return nil, err
+	}
+
+	// Default to detecting the strategy from the repository
+	if strategy == "" {
+		strategy = AutoStrategy
+	}
+
+	if err := ValidateStrategy(strategy); err != nil {
+		return nil, err
+	}
+
+	if err := retry.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := install.Validate(); err != nil {
+		return nil, err
 	}
 
 	// Set default dotfile path if not provided
@@ -49,8 +83,15 @@ func InitializeConfigurations(
 		dotfilePath = path.Join(homeDir, "dotfiles")
 	}
 
+	// Repository operations and links into the repository need an absolute path
+	absDotfilePath, err := filepath.Abs(dotfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dotfile path: %w", err)
+	}
+	dotfilePath = absDotfilePath
+
 	// Set up configuration directory
-	configPath, err := func() (string, error) {
+	configPath, err = func() (string, error) {
 		if configPath == "" {
 			configPath, err := os.UserConfigDir()
 			if err != nil {
@@ -90,6 +131,57 @@ func InitializeConfigurations(
 		return nil, err
 	}
 
+	// SSH URLs authenticate with the key file, or the SSH agent without one
+	if sshKey != "" {
+		if !isSSHUrl(gitUrl) {
+			return nil, fmt.Errorf("an SSH key requires an SSH git url, got %s", gitUrl)
+		}
+		if _, err := sshPublicKeys(gitUrl, sshKey); err != nil {
+			return nil, err
+		}
+	}
+
+	// Select the hosting provider from the Git URL unless given
+	gitHost, err := getRepoValue(gitUrl, "host")
+	if err != nil {
+		return nil, err
+	}
+
+	detect := provider == "" || provider == AutoProvider
+	if detect {
+		provider = DetectProvider(gitHost)
+	}
+
+	if err := ValidateProvider(provider); err != nil {
+		return nil, err
+	}
+
+	// The token is optional: it authenticates API requests and HTTPS clones. The git
+	// provider uses the token variables of the host's provider, for cloning private
+	// repositories; hosts of unknown providers get no token.
+	tokenEnv := providerTokenEnv[provider]
+	if provider == GitProvider {
+		tokenEnv = providerTokenEnv[DetectProvider(gitHost)]
+	}
+
+	var gitToken string
+	for _, name := range tokenEnv {
+		if token, ok := os.LookupEnv(name); ok && token != "" {
+			gitToken = token
+			break
+		}
+	}
+
+	// Without token, detected API providers fall back to listing the remote refs
+	if gitToken == "" && detect && provider != GitProvider {
+		Infoln("No", strings.Join(tokenEnv, " or "), "environment variable found, using git ls-remote to find remote commits")
+		provider = GitProvider
+	}
+
+	if gitApiBaseUrl == "" && provider != GitProvider {
+		gitApiBaseUrl = DefaultApiBaseUrl(provider, gitHost)
+	}
+
 	// Log all configuration values for debugging
 	// ################## CONFIGURATIONS ##################
 	Infoln("Configuration Path ->", configPath)
@@ -100,38 +192,73 @@ func InitializeConfigurations(
 		h, _ := os.UserHomeDir()
 		return h
 	}())
-	Infoln("API Base Url ->", githubApiBaseUrl)
+	Infoln("Git Provider ->", provider)
+	Infoln("API Base Url ->", gitApiBaseUrl)
 	Infoln("WebHook ->", webHook)
 	Infoln("Git Url ->", gitUrl)
+	if isSSHUrl(gitUrl) {
+		Infoln("SSH Key ->", func() string {
+			if sshKey == "" {
+				return "SSH agent"
+			}
+			return sshKey
+		}())
+	}
+	Infoln("Git Ref ->", ref)
 	Infoln("Port ->", port)
+	Infoln("Sync Strategy ->", strategy)
+	Infoln("Auto Install ->", func() string {
+		if install.AutoInstall == "" {
+			return "from " + DotfileConfigName
+		}
+		return install.AutoInstall
+	}(), "(confirmation: "+install.Confirmation+")")
+	Infoln("Retry Policy ->", fmt.Sprintf("%d attempts, %s base delay, %s max delay, %.0f%% jitter", retry.Attempts, retry.BaseDelay, retry.MaxDelay, retry.Jitter*100))
 	// #################################################
 
 	config := &Configurations{
 		DotfilePath:     dotfilePath,
 		WebHook:         webHook,
 		Port:            port,
-		GithubToken:     gitToken,
+		Token:           gitToken,
 		ConfigPath:      configPath,
 		GitUrl:          gitUrl,
+		SSHKey:          sshKey,
 		GitRepository:   repoName,
 		RepositoryOwner: repoOwner,
-		GitApiBaseUrl:   githubApiBaseUrl,
+		Provider:        provider,
+		GitApiBaseUrl:   gitApiBaseUrl,
+		Ref:             GitRef(ref),
+		Strategy:        strategy,
+		Retry:           retry,
+		Install:         install,
 	}
 
 	return config, nil
 
 }
 
+// RepoPath returns the path of the local clone of the repository.
+// Repository operations use it instead of the working directory, which is shared by
+// every goroutine of the process.
+func (c *Configurations) RepoPath() string {
+	return filepath.Join(c.DotfilePath, c.GitRepository)
+}
+
 // getRepoValue extracts repository information from a Git URL.
-// filter can be "repository" (returns repo name) or "repoOwner" (returns owner/org name).
-// Expects URLs in format: https://github.com/owner/repository.git
+// filter can be "repository" (returns repo name), "repoOwner" (returns owner/org name,
+// or the group path such as group/subgroup for nested GitLab groups) or "host".
+// Expects URLs in format: https://github.com/owner/repository.git, ssh://git@host:2222/owner/repository,
+// git@github.com:owner/repository.git, file:///srv/git/repository or a local path to a repository.
+// The host of SSH URLs is the web host, without port, used to find the API.
 func getRepoValue(gitUrl string, filter string) (string, error) {
-	parsedURL, err := url.Parse(gitUrl)
+	parsedURL, err := parseGitUrl(gitUrl)
 	if err != nil {
 		return "", errors.New("unable to parse git url")
 	}
 
-	if !strings.HasSuffix(parsedURL.Path, ".git") {
+	// SSH URLs, local paths and file:// URLs may name a repository without .git suffix
+	if (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") && !strings.HasSuffix(parsedURL.Path, ".git") {
 		return "", errors.New("not a git url")
 	}
 
@@ -150,7 +277,12 @@ func getRepoValue(gitUrl string, filter string) (string, error) {
 		case "repository":
 			return segments[len(segments)-1], nil
 		case "repoOwner":
-			return segments[len(segments)-2], nil
+			return strings.Join(segments[:len(segments)-1], "/"), nil
+		case "host":
+			if host, ok := sshHostAliases[parsedURL.Hostname()]; ok {
+				return host, nil
+			}
+			return parsedURL.Hostname(), nil
 		default:
 			return "", fmt.Errorf("invalid filter: %s", filter)
 		}
@@ -162,3 +294,34 @@ func getRepoValue(gitUrl string, filter string) (string, error) {
 
 	return strings.TrimSuffix(repoVal, ".git"), nil
 }
+
+// scpUrlPattern matches scp-like git URLs such as git@github.com:owner/repository.git,
+// with a path relative to the home directory or absolute (git@host:/srv/repository.git)
+var scpUrlPattern = regexp.MustCompile(`^(?:([^@/:]+)@)?([^@/:]{2,}):(/?[^/].*)$`)
+
+// sshHostAliases maps the SSH-over-HTTPS-port hosts of providers to their web host
+var sshHostAliases = map[string]string{
+	"ssh.github.com":       "github.com",
+	"altssh.gitlab.com":    "gitlab.com",
+	"altssh.bitbucket.org": "bitbucket.org",
+}
+
+// parseGitUrl parses a git URL, converting scp-like URLs (user@host:path) to ssh:// URLs
+func parseGitUrl(gitUrl string) (*url.URL, error) {
+	if !strings.Contains(gitUrl, "://") {
+		if match := scpUrlPattern.FindStringSubmatch(gitUrl); match != nil {
+			user := ""
+			if match[1] != "" {
+				user = match[1] + "@"
+			}
+			return url.Parse("ssh://" + user + match[2] + "/" + strings.TrimPrefix(match[3], "/"))
+		}
+	}
+	return url.Parse(gitUrl)
+}
+
+// isSSHUrl reports whether a git URL is cloned over SSH
+func isSSHUrl(gitUrl string) bool {
+	parsedURL, err := parseGitUrl(gitUrl)
+	return err == nil && (parsedURL.Scheme == "ssh" || parsedURL.Scheme == "git+ssh")
+}
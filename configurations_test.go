@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetRepoValue(t *testing.T) {
+	tests := []struct {
+		gitUrl     string
+		host       string
+		owner      string
+		repository string
+	}{
+		{"https://github.com/jane/dotfiles.git", "github.com", "jane", "dotfiles"},
+		{"https://gitlab.com/group/subgroup/dotfiles.git", "gitlab.com", "group/subgroup", "dotfiles"},
+		{"git@github.com:jane/dotfiles.git", "github.com", "jane", "dotfiles"},
+		{"github.com:jane/dotfiles", "github.com", "jane", "dotfiles"},
+		{"git@git.example.com:/srv/git/dotfiles.git", "git.example.com", "srv/git", "dotfiles"},
+		{"ssh://git@ssh.github.com:443/jane/dotfiles.git", "github.com", "jane", "dotfiles"},
+		{"file:///srv/git/dotfiles.git", "", "srv/git", "dotfiles"},
+		{"/srv/git/dotfiles.git", "", "srv/git", "dotfiles"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.gitUrl, func(t *testing.T) {
+			for filter, want := range map[string]string{"host": test.host, "repoOwner": test.owner, "repository": test.repository} {
+				got, err := getRepoValue(test.gitUrl, filter)
+				if err != nil {
+					t.Fatalf("%s: %v", filter, err)
+				}
+				if got != want {
+					t.Errorf("%s is %q, want %q", filter, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseGitUrlScpLike(t *testing.T) {
+	tests := map[string]string{
+		"git@github.com:jane/dotfiles.git":          "ssh://git@github.com/jane/dotfiles.git",
+		"git@git.example.com:/srv/git/dotfiles.git": "ssh://git@git.example.com/srv/git/dotfiles.git",
+		"example.com:dotfiles.git":                  "ssh://example.com/dotfiles.git",
+	}
+
+	for gitUrl, want := range tests {
+		parsedURL, err := parseGitUrl(gitUrl)
+		if err != nil {
+			t.Errorf("%s: %v", gitUrl, err)
+			continue
+		}
+		if got := parsedURL.String(); got != want {
+			t.Errorf("parseGitUrl(%q) = %s, want %s", gitUrl, got, want)
+		}
+	}
+}
+
+func TestGitAuthInvalidSSHKey(t *testing.T) {
+	git := Git{&Configurations{
+		GitUrl: "git@github.com:jane/dotfiles.git",
+		SSHKey: filepath.Join(t.TempDir(), "missing_key"),
+	}}
+
+	if _, err := git.auth(); err == nil || !errors.As(err, &permanentError{}) {
+		t.Fatalf("got error %v, want a permanent error", err)
+	}
+	if _, err := git.listRemote(); err == nil || !strings.Contains(err.Error(), "missing_key") {
+		t.Fatalf("listing the remote got error %v, want the key error", err)
+	}
+}
+
+func TestInitializeConfigurationsAbsoluteRepoPath(t *testing.T) {
+	root := t.TempDir()
+	chdir(t, root)
+
+	config, err := InitializeConfigurations("dotfiles", "", "3000", root, "file:///srv/git/dotfiles.git", "", AutoProvider, "",
+		DefaultRef, AutoStrategy, DefaultRetryPolicy, DefaultInstallPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := filepath.Join(root, "dotfiles", "dotfiles"); config.RepoPath() != want {
+		t.Errorf("repository path is %s, want %s", config.RepoPath(), want)
+	}
+}
+
+// chdir changes the working directory for the duration of a test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(workDir) })
+}
@@ -18,3 +18,27 @@ const (
 	// AutomaticSync indicates a sync was triggered automatically (webhook or polling)
 	AutomaticSync = "Automatic"
 )
+
+// Sync strategies selectable with --strategy or the `strategy:` key of dotfile-config.yaml
+const (
+	// AutoStrategy detects the strategy from the repository contents
+	AutoStrategy = "auto"
+
+	// EnhancedStrategy syncs the `dotfiles:` configuration format
+	EnhancedStrategy = "enhanced"
+
+	// LegacyStrategy syncs the nested `home: [...]` configuration format
+	LegacyStrategy = "legacy"
+
+	// StowStrategy links GNU stow packages into the home directory
+	StowStrategy = "stow"
+)
+
+// DefaultRef is the git ref tracked when --ref is not given
+const DefaultRef = "main"
+
+// sshKeyPassphraseEnv is the environment variable holding the passphrase of the --ssh-key key
+const sshKeyPassphraseEnv = "DOTFILE_SSH_KEY_PASSPHRASE"
+
+// DotfileConfigName is the name of the configuration file at the root of the dotfiles repository
+const DotfileConfigName = "dotfile-config.yaml"
@@ -30,6 +30,8 @@ type ConfigPathInfo struct {
 	Src   *os.File // Source file handle in the repository
 	Dest  string   // Destination path on the system
 	IsDir bool     // Whether this is a directory (ends with ;)
+
+	Software string // Software entry the file belongs to, empty for the legacy config
 }
 
 // NewCustomerSyncer creates a new custom syncer instance
@@ -56,46 +58,7 @@ func (c customSync) Sync(consumers ...Consumer) {
 
 	notify(&Git{c.config}, c.brokerNotifier)
 
-	go func() {
-		steps := syncSteps(c.git)
-
-		constant := 100 / len(steps)
-		event := SyncEvent{
-			Data: struct {
-				Progress  int    `json:"progress"`
-				IsSuccess bool   `json:"isSuccess"`
-				Step      string `json:"step"`
-				Error     string `json:"error"`
-				Done      bool   `json:"done"`
-			}{Progress: 0, IsSuccess: true, Done: false},
-		}
-
-		ch <- event
-
-		for i, step := range steps {
-			event.Data.Step = step.Step
-			err := step.Action()
-			if err != nil {
-				event.Data.IsSuccess = false
-				event.Data.Error = err.Error()
-				ch <- event
-				break
-			}
-
-			event.Data.IsSuccess = true
-			event.Data.Progress += constant
-			if i == len(steps)-1 { // on final step
-				event.Data.Done = true
-				progress := event.Data.Progress
-				if progress != 100 {
-					event.Data.Progress += 100 - progress
-				}
-			}
-			ch <- event
-		}
-
-		close(ch)
-	}()
+	go runSyncSteps(syncSteps(c.git), c.config.Retry, ch)
 
 	// Add broker notifier as a consumer
 	consumers = append(consumers, func(event SyncEvent) {
@@ -154,21 +117,16 @@ func generatePaths(node map[string]interface{}, currentPath string, paths *[]str
 
 // syncSteps defines the sequence of operations for synchronization.
 // Each step has a description and an action function that performs the work.
-func syncSteps(git *Git) []struct {
-	Step   string
-	Action func() error
-} {
+func syncSteps(git *Git) []SyncStep {
 
 	var (
 		configPathsInfo []ConfigPathInfo
 	)
 
-	return []struct {
-		Step   string
-		Action func() error
-	}{
+	return []SyncStep{
 		{
-			Step: "Git Repository checkout",
+			Step:  "Git Repository checkout",
+			Retry: true,
 			Action: func() error {
 				return git.CloneOrPullRepository()
 			},
@@ -176,13 +134,10 @@ func syncSteps(git *Git) []struct {
 		{
 			Step: "Parse dotfile configurations",
 			Action: func() error {
-				wd, err := os.Getwd()
-				if err != nil {
-					return err
-				}
+				repoDir := git.config.RepoPath()
 
 				configPaths, err := func() ([]string, error) {
-					configFile, err := os.ReadFile(path.Join(wd, "dotfile-config.yaml"))
+					configFile, err := os.ReadFile(path.Join(repoDir, "dotfile-config.yaml"))
 					if err != nil {
 						return nil, errors.New("skipping sync because dotfile-config.yaml does not exist in this repo")
 					}
@@ -213,9 +168,9 @@ func syncSteps(git *Git) []struct {
 				}
 
 				// Match config paths with actual files in repository
-				dirs, err := os.ReadDir(wd)
+				dirs, err := os.ReadDir(repoDir)
 				for _, info := range dirs {
-					f, err := os.Open(path.Join(wd, info.Name()))
+					f, err := os.Open(path.Join(repoDir, info.Name()))
 					if err != nil {
 						return err
 					}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InstallOrder returns the config entries sorted so that every entry comes after
+// the entries listed in its depends_on. Entries keep their config order otherwise.
+// When software names are given, only those entries and their transitive
+// dependencies are returned. Unknown dependencies and dependency cycles are errors.
+func (c *EnhancedConfig) InstallOrder(software ...string) ([]DotfileEntry, error) {
+	entries := make(map[string]DotfileEntry, len(c.Dotfiles))
+	for _, entry := range c.Dotfiles {
+		entries[entry.Software] = entry
+	}
+
+	if len(software) == 0 {
+		software = c.GetSoftwareList()
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		state = make(map[string]int, len(entries))
+		stack []string
+		order []DotfileEntry
+	)
+
+	var visit func(name string, parent string) error
+	visit = func(name string, parent string) error {
+		entry, ok := entries[name]
+		if !ok {
+			if parent == "" {
+				return fmt.Errorf("software %s not found in config", name)
+			}
+			return fmt.Errorf("%s depends on unknown software %s", parent, name)
+		}
+
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// Report the cycle starting from the first occurrence of name on the stack
+			for i, s := range stack {
+				if s == name {
+					return fmt.Errorf("dependency cycle detected: %s -> %s", strings.Join(stack[i:], " -> "), name)
+				}
+			}
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dependency := range entry.DependsOn {
+			if err := visit(dependency, name); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+
+		order = append(order, entry)
+		return nil
+	}
+
+	for _, name := range software {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// failedDependency returns the first dependency of an entry found in failed, or "" if none failed
+func failedDependency(entry DotfileEntry, failed map[string]bool) string {
+	for _, dependency := range entry.DependsOn {
+		if failed[dependency] {
+			return dependency
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// dependencyTestConfig returns a config with the entries in order, each depending on the listed software
+func dependencyTestConfig(entries ...[]string) *EnhancedConfig {
+	config := &EnhancedConfig{}
+	for _, entry := range entries {
+		config.Dotfiles = append(config.Dotfiles, DotfileEntry{Software: entry[0], DependsOn: entry[1:]})
+	}
+	return config
+}
+
+func TestInstallOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *EnhancedConfig
+		software []string
+		want     string // Software in install order, comma separated
+		err      string
+	}{
+		{
+			name:   "chain",
+			config: dependencyTestConfig([]string{"app", "runtime"}, []string{"runtime", "base"}, []string{"base"}),
+			want:   "base,runtime,app",
+		},
+		{
+			name:   "diamond",
+			config: dependencyTestConfig([]string{"top", "left", "right"}, []string{"left", "base"}, []string{"right", "base"}, []string{"base"}),
+			want:   "base,left,right,top",
+		},
+		{
+			name:   "independent entries keep config order",
+			config: dependencyTestConfig([]string{"zsh"}, []string{"git"}, []string{"vim"}),
+			want:   "zsh,git,vim",
+		},
+		{
+			name:     "selected software with its dependencies",
+			config:   dependencyTestConfig([]string{"top", "left", "right"}, []string{"left", "base"}, []string{"right", "base"}, []string{"base"}),
+			software: []string{"left"},
+			want:     "base,left",
+		},
+		{
+			name:   "cycle",
+			config: dependencyTestConfig([]string{"zsh"}, []string{"a", "b"}, []string{"b", "c"}, []string{"c", "a"}),
+			err:    "dependency cycle detected: a -> b -> c -> a",
+		},
+		{
+			name:   "self dependency",
+			config: dependencyTestConfig([]string{"a", "a"}),
+			err:    "dependency cycle detected: a -> a",
+		},
+		{
+			name:   "unknown dependency",
+			config: dependencyTestConfig([]string{"app", "missing"}),
+			err:    "app depends on unknown software missing",
+		},
+		{
+			name:     "unknown software",
+			config:   dependencyTestConfig([]string{"app"}),
+			software: []string{"missing"},
+			err:      "software missing not found in config",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order, err := test.config.InstallOrder(test.software...)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, entry := range order {
+				names = append(names, entry.Software)
+			}
+			if got := strings.Join(names, ","); got != test.want {
+				t.Errorf("got order %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInstallSkipsDependentsOfFailedSoftware(t *testing.T) {
+	// Names that are not on PATH, so that the installed check does not skip them
+	config := &EnhancedConfig{Dotfiles: []DotfileEntry{
+		{Software: "dotfile-test-app", Install: "true", DependsOn: []string{"dotfile-test-runtime"}},
+		{Software: "dotfile-test-runtime", Install: "true", DependsOn: []string{"dotfile-test-base"}},
+		{Software: "dotfile-test-base", Install: "exit 1"},
+		{Software: "dotfile-test-other", Install: "true"},
+	}}
+
+	report, err := NewInstaller(config).Install()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"dotfile-test-base":    InstallFailed,
+		"dotfile-test-runtime": InstallSkipped,
+		"dotfile-test-app":     InstallSkipped,
+		"dotfile-test-other":   InstallInstalled,
+	}
+	for _, result := range report.Results {
+		if result.Status != want[result.Software] {
+			t.Errorf("%s is %s (%s), want %s", result.Software, result.Status, result.Reason, want[result.Software])
+		}
+	}
+	if len(report.Results) != len(want) {
+		t.Errorf("got %d results, want %d", len(report.Results), len(want))
+	}
+
+	reasons := map[string]string{
+		"dotfile-test-runtime": "dependency dotfile-test-base was not installed",
+		"dotfile-test-app":     "dependency dotfile-test-runtime was not installed",
+	}
+	for _, result := range report.Results {
+		if reason, ok := reasons[result.Software]; ok && result.Reason != reason {
+			t.Errorf("%s skipped because %q, want %q", result.Software, result.Reason, reason)
+		}
+	}
+	if notInstalled := strings.Join(report.NotInstalled(), ","); notInstalled != "dotfile-test-base,dotfile-test-runtime,dotfile-test-app" {
+		t.Errorf("not installed: %s", notInstalled)
+	}
+}
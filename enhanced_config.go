@@ -4,47 +4,260 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"runtime"
+	"slices"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // EnhancedConfig represents the new structured configuration format
 type EnhancedConfig struct {
-	Dotfiles []DotfileEntry `yaml:"dotfiles"`
+	Strategy    string         `yaml:"strategy,omitempty"`     // Optional sync strategy override for the repository
+	AutoInstall string         `yaml:"auto_install,omitempty"` // Install software during syncs: never, new or always
+	Dotfiles    []DotfileEntry `yaml:"dotfiles"`
 }
 
 // DotfileEntry represents a software and its associated dotfiles
 type DotfileEntry struct {
-	Software string      `yaml:"software"`
-	Install  interface{} `yaml:"install"` // Can be string or map[string]string
-	Files    []FileSpec  `yaml:"files"`
+	Software  string              `yaml:"software"`
+	Recipe    string              `yaml:"recipe,omitempty"`     // Built-in recipe providing defaults (recipes.yaml)
+	Install   interface{}         `yaml:"install,omitempty"`    // Can be string or map[string]string
+	Uninstall interface{}         `yaml:"uninstall,omitempty"`  // Removal command, string or platform map like install
+	Packages  PackageSpec         `yaml:"packages,omitempty"`   // Packages per package manager, used when install has no command
+	DependsOn []string            `yaml:"depends_on,omitempty"` // Software that must be installed first
+	Check     *InstallCheck       `yaml:"check,omitempty"`      // Probe telling whether the software is installed
+	Version   *VersionRequirement `yaml:"version,omitempty"`    // Supported versions of the installed software
+	Timeout   time.Duration       `yaml:"timeout,omitempty"`    // Install command timeout, e.g. 10m (default: 30m)
+	Env       map[string]string   `yaml:"env,omitempty"`        // Extra environment variables of the install command
+	When      *EntryCondition     `yaml:"when,omitempty"`       // Machines the entry applies to (default: all)
+	Files     []FileSpec          `yaml:"files"`
+
+	recipe *DotfileEntry // Catalog recipe the entry falls back to
+}
+
+// EntryCondition restricts an entry to some machines. Every non-empty list must match.
+type EntryCondition struct {
+	Platforms []string `yaml:"platforms,omitempty"` // Platform keys, e.g. darwin, linux/ubuntu or linux/arm64
+	Hosts     []string `yaml:"hosts,omitempty"`     // Hostnames, with * and ? wildcards (e.g. work-*)
 }
 
-// GetInstallCommand returns the install command for the current platform
+// Matches reports whether a host satisfies the condition, and otherwise why not
+func (c *EntryCondition) Matches(host Host) (bool, string) {
+	if c == nil {
+		return true, ""
+	}
+
+	if len(c.Platforms) > 0 {
+		keys := host.Platform.Keys()
+		if !slices.ContainsFunc(c.Platforms, func(platform string) bool {
+			return slices.Contains(keys, normalizePlatformKey(platform))
+		}) {
+			return false, "platform " + host.Platform.String() + " not in " + strings.Join(c.Platforms, ", ")
+		}
+	}
+
+	if len(c.Hosts) > 0 {
+		hostname := strings.ToLower(host.Hostname)
+		short, _, _ := strings.Cut(hostname, ".")
+		if !slices.ContainsFunc(c.Hosts, func(pattern string) bool {
+			pattern = strings.ToLower(pattern)
+			matched, _ := path.Match(pattern, hostname)
+			matchedShort, _ := path.Match(pattern, short)
+			return matched || matchedShort
+		}) {
+			return false, "host " + host.Hostname + " not in " + strings.Join(c.Hosts, ", ")
+		}
+	}
+
+	return true, ""
+}
+
+// validate checks the host patterns of the condition
+func (c *EntryCondition) validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, pattern := range c.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid host pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// installTarget is the machine install commands are resolved for
+type installTarget struct {
+	platform   Platform
+	manager    *PackageManager                                           // Package manager, nil if none is available
+	managerErr error                                                     // Why no package manager is available
+	command    func(m PackageManager, packages []string) (string, error) // Builds package manager commands
+}
+
+// currentInstallTarget returns the install target of this machine
+func currentInstallTarget() installTarget {
+	manager, err := DetectPackageManager()
+	return installTarget{platform: CurrentPlatform(), manager: manager, managerErr: err, command: PackageManager.Command}
+}
+
+// previewInstallTarget returns the install target of another machine, using a package manager (nil if it has none)
+func previewInstallTarget(platform Platform, manager *PackageManager) installTarget {
+	target := installTarget{platform: platform, manager: manager, command: PackageManager.PreviewCommand}
+	if manager == nil {
+		target.managerErr = fmt.Errorf("no package manager known for platform: %s", platform)
+	}
+	return target
+}
+
+// GetInstallCommand returns the install command for the current platform.
+// An explicit install command wins; otherwise the command is built from the
+// packages of the detected package manager. Entries with neither for the
+// platform use their recipe.
 func (d *DotfileEntry) GetInstallCommand() (string, error) {
-	switch v := d.Install.(type) {
+	return d.installCommand(currentInstallTarget())
+}
+
+// GetInstallCommandFor returns the install command for another platform and package manager
+// (nil if it has none), without looking at this machine. Package manager commands are
+// prefixed with sudo when the manager requires root.
+func (d *DotfileEntry) GetInstallCommandFor(platform Platform, manager *PackageManager) (string, error) {
+	return d.installCommand(previewInstallTarget(platform, manager))
+}
+
+// installCommand returns the install command for a target
+func (d *DotfileEntry) installCommand(target installTarget) (string, error) {
+	if source := d.installSource(target); source != d {
+		return source.installCommand(target)
+	}
+
+	command, err := d.getInstallCommand(target.platform)
+	if err == nil || len(d.Packages) == 0 {
+		return command, err
+	}
+
+	if target.manager == nil {
+		return "", target.managerErr
+	}
+
+	packages := d.Packages.Packages(target.manager)
+	if len(packages) == 0 {
+		return "", fmt.Errorf("no packages for package manager: %s", target.manager.Name)
+	}
+
+	return target.command(*target.manager, packages)
+}
+
+// SystemPackages returns the packages to install with the detected package manager.
+// It returns nil when the entry has an explicit install command for this platform,
+// or when no package manager or no package for it is available.
+func (d *DotfileEntry) SystemPackages() []string {
+	target := currentInstallTarget()
+	if source := d.installSource(target); source != d {
+		return source.SystemPackages()
+	}
+
+	if _, err := d.getInstallCommand(target.platform); err == nil {
+		return nil
+	}
+
+	return d.Packages.Packages(target.manager)
+}
+
+// getInstallCommand returns the explicit install command for a platform.
+// For releases it returns a description of the download.
+func (d *DotfileEntry) getInstallCommand(platform Platform) (string, error) {
+	value, err := d.resolveInstall(platform)
+	if err != nil {
+		return "", err
+	}
+
+	if spec, ok := value.(*ReleaseSpec); ok {
+		release, err := spec.Resolve(platform)
+		if err != nil {
+			return "", err
+		}
+		return release.String(), nil
+	}
+
+	return value.(string), nil
+}
+
+// GetUninstallCommand returns the uninstall command for the current platform
+func (d *DotfileEntry) GetUninstallCommand() (string, error) {
+	return d.GetUninstallCommandFor(CurrentPlatform())
+}
+
+// GetUninstallCommandFor returns the uninstall command for a platform
+func (d *DotfileEntry) GetUninstallCommandFor(platform Platform) (string, error) {
+	switch v := d.Uninstall.(type) {
 	case string:
-		// Simple string command
 		return v, nil
 	case map[string]interface{}:
-		// Platform-specific commands
-		platform := GetPlatform()
-
-		// Check for platform-specific command
-		if cmd, ok := v[platform]; ok {
+		if cmd, _, ok := platform.Resolve(v); ok {
 			return fmt.Sprintf("%v", cmd), nil
 		}
+		return "", fmt.Errorf("no uninstall command for platform: %s", platform)
+	case nil:
+		return "", fmt.Errorf("no uninstall command defined")
+	default:
+		return "", fmt.Errorf("invalid uninstall command format")
+	}
+}
 
-		// Check for 'all' platform (cross-platform)
-		if cmd, ok := v["all"]; ok {
-			return fmt.Sprintf("%v", cmd), nil
+// GetRelease returns the release to install on the current platform,
+// or nil if the entry is not installed from a release
+func (d *DotfileEntry) GetRelease() (*ResolvedRelease, error) {
+	return d.release(currentInstallTarget())
+}
+
+// release returns the release to install on a target, or nil if the entry is not installed from a release
+func (d *DotfileEntry) release(target installTarget) (*ResolvedRelease, error) {
+	if source := d.installSource(target); source != d {
+		return source.release(target)
+	}
+
+	value, err := d.resolveInstall(target.platform)
+	if err != nil {
+		return nil, nil
+	}
+
+	if spec, ok := value.(*ReleaseSpec); ok {
+		return spec.Resolve(target.platform)
+	}
+	return nil, nil
+}
+
+// resolveInstall returns the install value for a platform: a command string or a *ReleaseSpec
+func (d *DotfileEntry) resolveInstall(platform Platform) (interface{}, error) {
+	value := d.Install
+	if v, ok := value.(map[string]interface{}); ok {
+		if _, isRelease := v[releaseKey]; !isRelease {
+			// Platform-specific values, from the most specific key
+			// (linux/ubuntu/arm64) down to the OS and 'all' (cross-platform)
+			resolved, _, ok := platform.Resolve(v)
+			if !ok {
+				return nil, fmt.Errorf("no install command for platform: %s", platform)
+			}
+			if _, ok := resolved.(map[string]interface{}); !ok {
+				return fmt.Sprintf("%v", resolved), nil
+			}
+			value = resolved
 		}
+	}
 
-		return "", fmt.Errorf("no install command for platform: %s", platform)
+	switch v := value.(type) {
+	case string:
+		// Simple string command
+		return v, nil
+	case map[string]interface{}:
+		if release, ok := v[releaseKey]; ok {
+			return parseReleaseSpec(release)
+		}
+		return nil, fmt.Errorf("invalid install command format")
+	case nil:
+		return nil, fmt.Errorf("no install command defined")
 	default:
-		return "", fmt.Errorf("invalid install command format")
+		return nil, fmt.Errorf("invalid install command format")
 	}
 }
 
@@ -54,8 +267,24 @@ type FileSpec struct {
 	Target string `yaml:"target"`
 }
 
-// ParseEnhancedConfig reads and parses the enhanced YAML configuration
+// Destination returns where the file is deployed, with 'home' in the target replaced by the home directory
+func (f FileSpec) Destination(homeDir string) string {
+	targetPath := strings.ReplaceAll(f.Target, "home", homeDir)
+	return path.Join(targetPath, strings.TrimSuffix(f.Path, ";"))
+}
+
+// ParseEnhancedConfig reads and parses the enhanced YAML configuration,
+// keeping the entries whose `when` condition matches this machine
 func ParseEnhancedConfig(configPath string) (*EnhancedConfig, error) {
+	config, err := readEnhancedConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return config.ForHost(CurrentHost()), nil
+}
+
+// readEnhancedConfig reads and parses the enhanced YAML configuration with the entries of every machine
+func readEnhancedConfig(configPath string) (*EnhancedConfig, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -66,9 +295,44 @@ func ParseEnhancedConfig(configPath string) (*EnhancedConfig, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
+	if err := config.applyRecipes(); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range config.Dotfiles {
+		if err := entry.When.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Software, err)
+		}
+	}
+
 	return &config, nil
 }
 
+// ForHost returns the config with only the entries whose `when` condition matches a host.
+// Dependencies on entries left out are dropped, since that host never installs them.
+func (c *EnhancedConfig) ForHost(host Host) *EnhancedConfig {
+	excluded := make(map[string]bool)
+	for _, entry := range c.Dotfiles {
+		if ok, _ := entry.When.Matches(host); !ok {
+			excluded[entry.Software] = true
+		}
+	}
+
+	config := *c
+	config.Dotfiles = make([]DotfileEntry, 0, len(c.Dotfiles))
+	for _, entry := range c.Dotfiles {
+		if excluded[entry.Software] {
+			continue
+		}
+		entry.DependsOn = slices.DeleteFunc(slices.Clone(entry.DependsOn), func(dependency string) bool {
+			return excluded[dependency]
+		})
+		config.Dotfiles = append(config.Dotfiles, entry)
+	}
+
+	return &config
+}
+
 // GetInstallCommands returns a map of software to installation commands
 func (c *EnhancedConfig) GetInstallCommands() map[string]string {
 	commands := make(map[string]string)
@@ -81,9 +345,9 @@ func (c *EnhancedConfig) GetInstallCommands() map[string]string {
 	return commands
 }
 
-// GetPlatform returns the current operating system platform
+// GetPlatform returns the current platform as os[/distro]/arch (e.g. linux/ubuntu/amd64, darwin/arm64)
 func GetPlatform() string {
-	return runtime.GOOS // Returns: linux, darwin, windows, freebsd, openbsd, etc.
+	return CurrentPlatform().String()
 }
 
 // GetConfigPaths converts the enhanced config to ConfigPathInfo format
@@ -95,13 +359,15 @@ func (c *EnhancedConfig) GetConfigPaths(repoDir string) ([]ConfigPathInfo, error
 	}
 
 	for _, entry := range c.Dotfiles {
-		for _, fileSpec := range entry.Files {
-			// Replace 'home' with actual home directory
-			targetPath := strings.ReplaceAll(fileSpec.Target, "home", homeDir)
-
-			// Construct full destination path
-			destPath := path.Join(targetPath, fileSpec.Path)
+		if entry.Version != nil && entry.Version.SkipFiles {
+			// Keep the current config of an unsupported version instead of deploying an incompatible one
+			if status := entry.CheckVersion(); status.Version != "" && !status.Satisfied {
+				Error("Skipping files of", entry.Software+":", "version", status.Version, "does not satisfy", status.Constraint)
+				continue
+			}
+		}
 
+		for _, fileSpec := range entry.Files {
 			// Check if it's a directory (ends with ;)
 			isDir := strings.HasSuffix(fileSpec.Path, ";")
 			cleanPath := strings.TrimSuffix(fileSpec.Path, ";")
@@ -116,8 +382,10 @@ func (c *EnhancedConfig) GetConfigPaths(repoDir string) ([]ConfigPathInfo, error
 
 			configPaths = append(configPaths, ConfigPathInfo{
 				Src:   srcFile,
-				Dest:  strings.TrimSuffix(destPath, ";"),
+				Dest:  fileSpec.Destination(homeDir),
 				IsDir: isDir,
+
+				Software: entry.Software,
 			})
 		}
 	}
@@ -134,6 +402,16 @@ func (c *EnhancedConfig) GetSoftwareList() []string {
 	return software
 }
 
+// GetEntry returns the entry of a software, or nil if it is not in the config
+func (c *EnhancedConfig) GetEntry(software string) *DotfileEntry {
+	for i := range c.Dotfiles {
+		if c.Dotfiles[i].Software == software {
+			return &c.Dotfiles[i]
+		}
+	}
+	return nil
+}
+
 // GetFilesBySoftware returns all files for a specific software
 func (c *EnhancedConfig) GetFilesBySoftware(software string) []FileSpec {
 	for _, entry := range c.Dotfiles {
@@ -3,8 +3,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"os"
-	"os/exec"
 	"path"
 	"sync"
 )
@@ -36,46 +34,7 @@ func (e enhancedSync) Sync(consumers ...Consumer) {
 
 	notify(&Git{e.config}, e.brokerNotifier)
 
-	go func() {
-		steps := enhancedSyncSteps(e.git)
-
-		constant := 100 / len(steps)
-		event := SyncEvent{
-			Data: struct {
-				Progress  int    `json:"progress"`
-				IsSuccess bool   `json:"isSuccess"`
-				Step      string `json:"step"`
-				Error     string `json:"error"`
-				Done      bool   `json:"done"`
-			}{Progress: 0, IsSuccess: true, Done: false},
-		}
-
-		ch <- event
-
-		for i, step := range steps {
-			event.Data.Step = step.Step
-			err := step.Action()
-			if err != nil {
-				event.Data.IsSuccess = false
-				event.Data.Error = err.Error()
-				ch <- event
-				break
-			}
-
-			event.Data.IsSuccess = true
-			event.Data.Progress += constant
-			if i == len(steps)-1 {
-				event.Data.Done = true
-				progress := event.Data.Progress
-				if progress != 100 {
-					event.Data.Progress += 100 - progress
-				}
-			}
-			ch <- event
-		}
-
-		close(ch)
-	}()
+	go runSyncSteps(enhancedSyncSteps(e.config, e.git), e.config.Retry, ch)
 
 	consumers = append(consumers, func(event SyncEvent) {
 		e.brokerNotifier.SyncEvent(event)
@@ -91,21 +50,16 @@ func (e enhancedSync) Sync(consumers ...Consumer) {
 	e.mutex.Unlock()
 }
 
-func enhancedSyncSteps(git *Git) []struct {
-	Step   string
-	Action func() error
-} {
+func enhancedSyncSteps(agentConfig *Configurations, git *Git) []SyncStep {
 	var (
 		configPathsInfo []ConfigPathInfo
-		_               *EnhancedConfig
+		enhancedConfig  *EnhancedConfig
 	)
 
-	return []struct {
-		Step   string
-		Action func() error
-	}{
+	return []SyncStep{
 		{
-			Step: "Git Repository checkout",
+			Step:  "Git Repository checkout",
+			Retry: true,
 			Action: func() error {
 				return git.CloneOrPullRepository()
 			},
@@ -113,12 +67,9 @@ func enhancedSyncSteps(git *Git) []struct {
 		{
 			Step: "Parse dotfile configurations",
 			Action: func() error {
-				wd, err := os.Getwd()
-				if err != nil {
-					return err
-				}
+				repoDir := git.config.RepoPath()
 
-				configPath := path.Join(wd, "dotfile-config.yaml")
+				configPath := path.Join(repoDir, DotfileConfigName)
 
 				// Try to parse as enhanced config first
 				config, err := ParseEnhancedConfig(configPath)
@@ -126,10 +77,10 @@ func enhancedSyncSteps(git *Git) []struct {
 					return errors.New("failed to parse dotfile-config.yaml: " + err.Error())
 				}
 
-				_ = config
+				enhancedConfig = config
 
 				// Convert to ConfigPathInfo
-				configPathsInfo, err = config.GetConfigPaths(wd)
+				configPathsInfo, err = config.GetConfigPaths(repoDir)
 				if err != nil {
 					return err
 				}
@@ -141,29 +92,80 @@ func enhancedSyncSteps(git *Git) []struct {
 				return nil
 			},
 		},
+		{
+			// Installs run before copying so that installers cannot overwrite synced dotfiles
+			Step: "Install new software",
+			Stream: func(output func(line string)) error {
+				return AutoInstall(agentConfig, enhancedConfig, output)
+			},
+		},
 		{
 			Step: "Copy dotfiles to configured locations",
 			Action: func() error {
+				// Stage every file first and swap them in together, so that a failure
+				// leaves all destinations as they were before the sync
+				tx := newDeployTransaction()
 				for _, configPathInfo := range configPathsInfo {
-					// Create parent directory if it doesn't exist
-					parentDir, _ := path.Split(configPathInfo.Dest)
-					if _, err := os.Stat(parentDir); err != nil {
-						if err := os.MkdirAll(parentDir, os.ModePerm); err != nil {
-							return fmt.Errorf("failed to create directory %s: %w", parentDir, err)
-						}
+					if err := tx.Stage(configPathInfo.Src.Name(), configPathInfo.Dest); err != nil {
+						return tx.Abort(fmt.Errorf("could not copy %s to %s: %w", configPathInfo.Src.Name(), configPathInfo.Dest, err))
 					}
+				}
 
-					// Copy file or directory
-					_, err := exec.Command("cp", "-r", configPathInfo.Src.Name(), configPathInfo.Dest).CombinedOutput()
-					if err != nil {
-						return fmt.Errorf("could not copy %s to %s: %w", configPathInfo.Src.Name(), configPathInfo.Dest, err)
-					}
+				if err := tx.Commit(); err != nil {
+					return tx.Abort(err)
+				}
 
+				for _, configPathInfo := range configPathsInfo {
 					Infoln(fmt.Sprintf("Synced: %s -> %s", configPathInfo.Src.Name(), configPathInfo.Dest))
 				}
 
+				// The files are deployed, failing to remember them only affects `software remove`
+				if err := saveDeploys(agentConfig.ConfigPath, enhancedConfig, configPathsInfo); err != nil {
+					Error("Failed to record deployed files:", err.Error())
+				}
+
 				return nil
 			},
 		},
 	}
 }
+
+// saveDeploys records the deployed files of every software in the agent state of a directory.
+// Records of software that is no longer in the config are kept until it is removed.
+func saveDeploys(stateDir string, config *EnhancedConfig, configPathsInfo []ConfigPathInfo) error {
+	if stateDir == "" {
+		return nil
+	}
+
+	state, err := LoadAgentState(stateDir)
+	if err != nil {
+		return err
+	}
+
+	deployed := make(map[string]DeployRecord)
+	for _, configPathInfo := range configPathsInfo {
+		record, ok := deployed[configPathInfo.Software]
+		if !ok {
+			record = DeployRecord{Files: make(map[string]string)}
+			if entry := config.GetEntry(configPathInfo.Software); entry != nil {
+				record.Uninstall, _ = entry.GetUninstallCommand()
+			}
+		}
+
+		digest, err := contentDigest(configPathInfo.Dest)
+		if err != nil {
+			return err
+		}
+		record.Files[configPathInfo.Dest] = digest
+		deployed[configPathInfo.Software] = record
+	}
+
+	if state.Deployed == nil {
+		state.Deployed = make(map[string]DeployRecord)
+	}
+	for software, record := range deployed {
+		state.Deployed[software] = record
+	}
+
+	return state.Save(stateDir)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// installLogDir is the directory under the agent config path receiving install logs
+const installLogDir = "logs"
+
+// defaultEnvAllowlist lists the environment variables passed to install commands.
+// Names ending with * match every variable with that prefix.
+var defaultEnvAllowlist = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TMPDIR", "LANG", "LC_*", "TZ", "XDG_*",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	"HOMEBREW_*", "SSL_CERT_FILE", "SSL_CERT_DIR", "SUDO_ASKPASS",
+	"SYSTEMROOT", "PROGRAMDATA", "APPDATA", "LOCALAPPDATA", "USERPROFILE", "COMSPEC", "PATHEXT",
+}
+
+// secretEnv lists environment variables of the agent that are never passed to commands, even if allowlisted
+var secretEnv = []string{"GITHUB_TOKEN", "GH_TOKEN", "GITLAB_TOKEN", "GITEA_TOKEN", "BITBUCKET_TOKEN", "DOTFILE_*"}
+
+// Executor runs install commands in a controlled environment: with a timeout, an environment
+// restricted to an allowlist, a scratch working directory and the output logged to a file
+type Executor struct {
+	Timeout time.Duration // Timeout of a command without its own, 0 disables it
+	Env     []string      // Environment variables passed to commands, names ending with * are prefixes
+	LogDir  string        // Directory receiving one log file per run, empty disables logging
+}
+
+// DefaultExecutor gives a command 30 minutes and the default environment allowlist
+var DefaultExecutor = Executor{Timeout: 30 * time.Minute, Env: defaultEnvAllowlist}
+
+// execCommand is a shell command run by an executorRun
+type execCommand struct {
+	Name    string            // Label of the command in the log
+	Script  string            // Shell command run through bash
+	Timeout time.Duration     // Overrides the executor timeout when set
+	Env     map[string]string // Extra environment variables
+}
+
+// ErrTimeout is returned when a command runs longer than its timeout
+var ErrTimeout = errors.New("timed out")
+
+// ErrSudoPassword is returned when a command fails because sudo asked for a password
+var ErrSudoPassword = errors.New("sudo requires a password")
+
+// sudoPasswordMessages are printed by sudo -n, and by sudo without terminal, instead of a prompt
+var sudoPasswordMessages = []string{"sudo: a password is required", "sudo: a terminal is required"}
+
+// executorRun holds the working directory and log file of a single run of commands
+type executorRun struct {
+	executor Executor
+	dir      string    // Scratch working directory, removed by Close
+	log      io.Writer // Log file, io.Discard when logging is disabled
+	logFile  *os.File
+	mutex    sync.Mutex // Serializes log writes of stdout and stderr
+}
+
+// start creates the working directory and log file of a run
+func (e Executor) start() (*executorRun, error) {
+	dir, err := os.MkdirTemp("", "dotfile-agent-install-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+
+	run := &executorRun{executor: e, dir: dir, log: io.Discard}
+	if e.LogDir == "" {
+		return run, nil
+	}
+
+	if err := os.MkdirAll(e.LogDir, 0700); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	name := "install-" + time.Now().Format("20060102-150405.000") + ".log"
+	file, err := os.OpenFile(filepath.Join(e.LogDir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create log file: %w", err)
+	}
+
+	run.log, run.logFile = file, file
+	return run, nil
+}
+
+// LogFile returns the path of the log file, or an empty string when logging is disabled
+func (r *executorRun) LogFile() string {
+	if r.logFile == nil {
+		return ""
+	}
+	return r.logFile.Name()
+}
+
+// Run executes a command in the working directory and returns its exit code.
+// On timeout, the whole process group is killed and ErrTimeout is returned.
+// Commands failing because sudo needs a password return ErrSudoPassword.
+func (r *executorRun) Run(command execCommand, stdout, stderr io.Writer) (int, error) {
+	timeout := command.Timeout
+	if timeout == 0 {
+		timeout = r.executor.Timeout
+	}
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "bash", "-c", command.Script)
+	cmd.Dir = r.dir
+	cmd.Env = sandboxEnv(r.executor.Env, command.Env)
+	cmd.Stdout = io.MultiWriter(stdout, r.logWriter())
+	sudo := &sudoPasswordDetector{}
+	cmd.Stderr = io.MultiWriter(stderr, r.logWriter(), sudo)
+	cmd.WaitDelay = 5 * time.Second // Don't wait forever for orphans holding the output open
+	killProcessGroup(cmd)
+
+	r.logf("=== %s: %s\n", command.Name, command.Script)
+	start := time.Now()
+	err := cmd.Run()
+
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%w after %s", ErrTimeout, timeout)
+	} else if err != nil && sudo.found {
+		err = fmt.Errorf("%w: run the agent as root or allow passwordless sudo (%v)", ErrSudoPassword, err)
+	}
+
+	if err != nil {
+		r.logf("=== %s failed after %s: %v\n\n", command.Name, time.Since(start).Round(time.Millisecond), err)
+	} else {
+		r.logf("=== %s succeeded after %s\n\n", command.Name, time.Since(start).Round(time.Millisecond))
+	}
+
+	return exitCode, err
+}
+
+// Close removes the working directory and closes the log file
+func (r *executorRun) Close() error {
+	err := os.RemoveAll(r.dir)
+	if r.logFile != nil {
+		err = errors.Join(err, r.logFile.Close())
+	}
+	return err
+}
+
+// logf writes a line to the log
+func (r *executorRun) logf(format string, args ...any) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, _ = fmt.Fprintf(r.log, format, args...)
+}
+
+// logWriter returns a writer appending command output to the log
+func (r *executorRun) logWriter() io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		_, _ = r.log.Write(p)
+		return len(p), nil
+	})
+}
+
+// sudoPasswordDetector watches the error output of a command for sudo asking for a password
+type sudoPasswordDetector struct {
+	tail  []byte // End of the output, for messages split across writes
+	found bool
+}
+
+func (d *sudoPasswordDetector) Write(p []byte) (int, error) {
+	if d.found {
+		return len(p), nil
+	}
+
+	d.tail = append(d.tail, p...)
+	for _, message := range sudoPasswordMessages {
+		if strings.Contains(string(d.tail), message) {
+			d.found = true
+		}
+	}
+	if len(d.tail) > 64 {
+		d.tail = d.tail[len(d.tail)-64:]
+	}
+	return len(p), nil
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// sandboxEnv returns the agent environment restricted to the allowlist, without
+// agent secrets, with extra variables added. Variables are sorted by name.
+func sandboxEnv(allowlist []string, extra map[string]string) []string {
+	env := make(map[string]string)
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if matchEnv(allowlist, name) && !matchEnv(secretEnv, name) {
+			env[name] = value
+		}
+	}
+	for name, value := range extra {
+		env[name] = value
+	}
+
+	result := make([]string, 0, len(env))
+	for name, value := range env {
+		result = append(result, name+"="+value)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// matchEnv reports whether a variable name matches a list of names and prefixes ending with *
+func matchEnv(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(name, prefix) || pattern == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup runs the command in a new session, whose process group is killed as a
+// whole on cancellation, so children of `curl | sh` scripts don't outlive a timeout. The
+// session has no controlling terminal: sudo and other prompts fail at once instead of
+// stopping the command until its timeout when reading /dev/tty from the background.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// killProcessGroup keeps the default cancellation, which kills the shell process
+func killProcessGroup(cmd *exec.Cmd) {}
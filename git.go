@@ -1,95 +1,96 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"os"
-	"os/exec"
 	"path"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
 )
 
-// Git provides operations for interacting with Git repositories and the GitHub API
+// Git provides operations for interacting with Git repositories and the API of their hosting provider
 type Git struct {
 	config *Configurations // Agent configuration containing repository details
 }
 
-// RemoteCommit fetches the latest commit from the remote GitHub repository using the GitHub API.
-// Returns the commit SHA and timestamp of the HEAD commit on the default branch.
+// RemoteCommit fetches the latest commit from the remote repository using the API of its provider.
+// Returns the commit SHA and timestamp of the commit the tracked ref points to.
+// It makes a single attempt, so that status queries answer without waiting for retries.
 func (g Git) RemoteCommit() (*Commit, error) {
-	gitUrl, err := url.Parse(fmt.Sprintf("%s/repos/%s/%s/commits", g.config.GitApiBaseUrl, g.config.RepositoryOwner, g.config.GitRepository))
-	if err != nil {
-		return nil, err
-	}
-
-	request, err := http.NewRequest(http.MethodGet, gitUrl.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	gitToken := g.config.GithubToken
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("Authorization", "Bearer "+gitToken)
+	return g.remoteCommit()
+}
 
-	response, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return nil, err
-	}
+// RemoteCommitWithRetry is RemoteCommit with transient failures retried according to the
+// configured retry policy, for the background checks deciding whether to sync.
+func (g Git) RemoteCommitWithRetry() (*Commit, error) {
+	var commit *Commit
+	err := g.config.Retry.Do(func() error {
+		var err error
+		commit, err = g.remoteCommit()
+		return err
+	}, logRetry("Fetching remote commit"))
 
-	statusCode := response.StatusCode
+	return commit, err
+}
 
-	if statusCode != 200 {
-		return nil, fmt.Errorf("unable to fetch remote commit: %v", statusCode)
+// remoteCommit performs a single remote commit lookup with the RemoteProvider.
+// Branches and tags are resolved to their full name on the remote first, like checkout
+// does, so that the provider looks up the same ref when a branch and a tag share a name.
+func (g Git) remoteCommit() (*Commit, error) {
+	ref := g.config.Ref
+	if !ref.IsCommit() {
+		// For a release channel, this is the newest matching tag
+		name, err := g.remoteRef()
+		if err != nil {
+			return nil, err
+		}
+		ref = GitRef(name)
 	}
 
-	var responseBody []GitHttpCommitResponse
-
-	err = json.NewDecoder(response.Body).Decode(&responseBody)
+	commit, err := NewRemoteProvider(g.config).Commit(string(ref))
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode response body: %v", err)
-	}
-
-	headCommit := responseBody[0]
-
-	commit := &Commit{
-		Id:   headCommit.Sha,
-		Time: headCommit.Commit.Author.Date,
+		return nil, err
 	}
 
+	commit.Ref = ref.shortName()
 	return commit, nil
 }
 
-// LocalCommit retrieves the latest commit from the local Git repository.
-// It executes 'git log HEAD -1' to get the most recent commit information.
+// LocalCommit retrieves the HEAD commit of the local Git repository
 func (g Git) LocalCommit() (*Commit, error) {
-	err := os.Chdir(g.config.DotfilePath + string(os.PathSeparator) + g.config.GitRepository)
+	repository, err := git.PlainOpen(g.config.RepoPath())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to open repository: %w", err)
 	}
 
-	gitPath, err := exec.LookPath("git")
+	head, err := repository.Head()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
 	}
 
-	headCommit, err := exec.Command(gitPath, "log", "HEAD", "-1").CombinedOutput()
+	headCommit, err := repository.CommitObject(head.Hash())
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to read HEAD commit: %w", err)
 	}
 
-	commitDetails := strings.Split(string(headCommit), "\n")
-
-	commitId := strings.Split(commitDetails[0], " ")[1]
-	commitTime := func() string {
-		n := strings.Replace(commitDetails[2], "Date:  ", "", 1)
-		return strings.TrimSpace(n)
-	}()
-
 	commit := &Commit{
-		Id:   commitId,
-		Time: commitTime,
+		Id:         headCommit.Hash.String(),
+		Time:       headCommit.Author.When.Format(time.RFC3339),
+		AuthorName: headCommit.Author.Name,
+		Message:    headCommit.Message,
 	}
 	return commit, nil
 }
@@ -106,40 +107,350 @@ func (g Git) IsSync(localCommit, remoteCommit *Commit) bool {
 }
 
 // CloneOrPullRepository clones the repository if it doesn't exist locally,
-// or pulls the latest changes if it already exists.
+// or fetches the latest changes if it already exists, and checks out the tracked ref.
 // This ensures the local repository is up-to-date with the remote.
 func (g Git) CloneOrPullRepository() error {
+	repoPath := g.config.RepoPath()
+
+	if _, err := os.Stat(repoPath); err != nil {
+		auth, err := g.auth()
+		if err != nil {
+			return err
+		}
+
+		// Repository doesn't exist, clone it
+		_, err = git.PlainClone(repoPath, false, &git.CloneOptions{
+			URL:  g.config.GitUrl,
+			Auth: auth,
+		})
+		if err != nil {
+			_ = os.RemoveAll(repoPath) // don't leave a partial clone behind for the next pull
+			return fmt.Errorf("failed to clone %s: %w", g.config.GitUrl, err)
+		}
+	}
+
+	repository, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
 
-	git, err := exec.LookPath("git")
+	return g.checkout(repository)
+}
+
+// checkout updates the worktree to the tracked ref. Branches are checked out and
+// fast-forwarded like `git pull`; tags, the newest tag of a release channel and
+// pinned commits are checked out detached.
+func (g Git) checkout(repository *git.Repository) error {
+	worktree, err := repository.Worktree()
 	if err != nil {
 		return err
 	}
 
-	return func() error {
-		repoPath := path.Join(g.config.DotfilePath, g.config.GitRepository)
-		_, err = os.Stat(repoPath) // checks if repo already exists
-		if err != nil {
-			// Repository doesn't exist, clone it
-			err = os.Chdir(g.config.DotfilePath)
-			if err != nil {
+	if g.config.Ref.IsCommit() {
+		hash := plumbing.NewHash(string(g.config.Ref))
+		if _, err := repository.CommitObject(hash); err != nil {
+			// Not fetched yet: every pushed commit is reachable from a branch or a tag
+			if err := g.fetch(repository, "+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"); err != nil {
 				return err
 			}
+		}
+		return worktree.Checkout(&git.CheckoutOptions{Hash: hash})
+	}
+
+	name, err := g.remoteRef()
+	if err != nil {
+		return err
+	}
 
-			err = exec.Command(git, "clone", g.config.GitUrl).Run()
+	if name.IsTag() {
+		if err := g.fetch(repository, gitconfig.RefSpec("+"+name+":"+name)); err != nil {
+			return err
+		}
+		hash, err := tagCommit(repository, name)
+		if err != nil {
+			return err
+		}
+		return worktree.Checkout(&git.CheckoutOptions{Hash: hash})
+	}
+
+	// Switch to the local branch first, creating it from the remote branch if needed
+	remoteName := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name.Short())
+	if err := g.fetch(repository, gitconfig.RefSpec("+"+name+":"+remoteName)); err != nil {
+		return err
+	}
+	if head, err := repository.Head(); err != nil || head.Name() != name {
+		_, err := repository.Reference(name, false)
+		checkout := &git.CheckoutOptions{Branch: name, Create: err != nil}
+		if checkout.Create {
+			remote, err := repository.Reference(remoteName, true)
 			if err != nil {
 				return err
 			}
+			checkout.Hash = remote.Hash()
+		}
+		if err := worktree.Checkout(checkout); err != nil {
+			return fmt.Errorf("failed to check out %s: %w", name.Short(), err)
+		}
+	}
 
-			return os.Chdir(g.config.GitRepository)
-		} else {
-			// Repository exists, pull latest changes
-			err = os.Chdir(repoPath)
-			if err != nil {
-				return err
+	auth, err := g.auth()
+	if err != nil {
+		return err
+	}
+
+	err = worktree.Pull(&git.PullOptions{
+		RemoteName:    git.DefaultRemoteName,
+		ReferenceName: name,
+		Auth:          auth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to pull: %w", err)
+	}
+
+	return nil
+}
+
+// remoteRef returns the full name of the tracked branch or tag on the remote (see GitRef.resolve)
+func (g Git) remoteRef() (plumbing.ReferenceName, error) {
+	refs, err := g.listRemote()
+	if err != nil {
+		return "", err
+	}
+
+	return g.config.Ref.resolve(refs)
+}
+
+// listRemote lists the refs of the remote repository like `git ls-remote`, with the clone
+// credentials. Annotated tags are followed by their peeled <tag>^{} entry.
+func (g Git) listRemote() ([]*plumbing.Reference, error) {
+	// An in-memory remote lists the refs without touching the local repository
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{g.config.GitUrl},
+	})
+	auth, err := g.auth()
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := remote.List(&git.ListOptions{Auth: auth, PeelingOption: git.AppendPeeled})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote refs: %w", err)
+	}
+	return refs, nil
+}
+
+// fetch fetches refspecs from origin, moving refs that were force-pushed
+func (g Git) fetch(repository *git.Repository, refSpecs ...gitconfig.RefSpec) error {
+	auth, err := g.auth()
+	if err != nil {
+		return err
+	}
+
+	err = repository.Fetch(&git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   refSpecs,
+		Auth:       auth,
+		Force:      true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch: %w", err)
+	}
+	return nil
+}
+
+// tagCommit returns the commit a lightweight or annotated tag points to
+func tagCommit(repository *git.Repository, name plumbing.ReferenceName) (plumbing.Hash, error) {
+	ref, err := repository.Reference(name, true)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tag, err := repository.TagObject(ref.Hash())
+	if errors.Is(err, plumbing.ErrObjectNotFound) {
+		return ref.Hash(), nil // lightweight tag
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return commit.Hash, nil
+}
+
+// auth returns the credentials used for clones and pulls: the SSH key for SSH URLs, the
+// token for HTTPS URLs, and nil otherwise so that SSH URLs without key use the SSH agent.
+// A key file that cannot be loaded is a permanent error, rather than falling back to the agent.
+func (g Git) auth() (transport.AuthMethod, error) {
+	if g.config.SSHKey != "" {
+		keys, err := sshPublicKeys(g.config.GitUrl, g.config.SSHKey)
+		if err != nil {
+			return nil, Permanent(err)
+		}
+		return keys, nil
+	}
+
+	if g.config.Token == "" || !strings.HasPrefix(g.config.GitUrl, "https://") {
+		return nil, nil
+	}
+
+	// The username is ignored by GitHub and Gitea; GitLab and Bitbucket expect these for tokens
+	switch username, password, ok := strings.Cut(g.config.Token, ":"); {
+	case ok:
+		return &githttp.BasicAuth{Username: username, Password: password}, nil
+	case g.config.Provider == GitlabProvider:
+		return &githttp.BasicAuth{Username: "oauth2", Password: g.config.Token}, nil
+	case g.config.Provider == BitbucketProvider:
+		return &githttp.BasicAuth{Username: "x-token-auth", Password: g.config.Token}, nil
+	default:
+		return &githttp.BasicAuth{Username: "git", Password: g.config.Token}, nil
+	}
+}
+
+// sshPublicKeys loads a private key for an SSH URL, decrypted with the passphrase in
+// DOTFILE_SSH_KEY_PASSPHRASE. The user comes from the URL, git if it names none.
+// Host keys are checked against SSH_KNOWN_HOSTS or ~/.ssh/known_hosts.
+func sshPublicKeys(gitUrl string, keyFile string) (*gitssh.PublicKeys, error) {
+	user := gitssh.DefaultUsername
+	if parsedURL, err := parseGitUrl(gitUrl); err == nil && parsedURL.User.Username() != "" {
+		user = parsedURL.User.Username()
+	}
+
+	keys, err := gitssh.NewPublicKeysFromFile(user, keyFile, os.Getenv(sshKeyPassphraseEnv))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", keyFile, err)
+	}
+	return keys, nil
+}
+
+// commitPattern matches a full commit SHA
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// GitRef is the ref tracked by the agent: a branch name, a tag name or a full commit SHA
+// pinning the agent to that commit. Branches and tags can also be written in full, as
+// refs/heads/<name> or refs/tags/<name>. A glob pattern such as v* is a release channel
+// following the newest matching tag by semantic version.
+type GitRef string
+
+// IsCommit reports whether the ref pins a commit
+func (r GitRef) IsCommit() bool {
+	return commitPattern.MatchString(string(r))
+}
+
+// IsPattern reports whether the ref is a tag pattern. Branch and tag names cannot contain
+// the glob characters *, ? and [.
+func (r GitRef) IsPattern() bool {
+	return strings.ContainsAny(string(r), "*?[")
+}
+
+// Validate checks that a tag pattern is a valid glob
+func (r GitRef) Validate() error {
+	if r == "" {
+		return errors.New("empty git ref")
+	}
+	if _, err := path.Match(string(r), ""); err != nil {
+		return fmt.Errorf("invalid tag pattern %q: %w", r, err)
+	}
+	return nil
+}
+
+// Matches reports whether a push to a ref (refs/heads/<name> or refs/tags/<name>) updates the
+// tracked ref. Pushes never update a pinned commit; a release channel is updated by pushes
+// of matching tags.
+func (r GitRef) Matches(pushed string) bool {
+	if r.IsPattern() {
+		name := plumbing.ReferenceName(pushed)
+		matched, _ := path.Match(string(r), name.Short())
+		return name.IsTag() && matched
+	}
+	return !r.IsCommit() && slices.Contains(r.candidates(), plumbing.ReferenceName(pushed))
+}
+
+// resolve returns the full name of the branch or tag among the refs of the remote.
+// Branches win over tags of the same name, like in git. For a tag pattern, it is
+// the newest matching tag.
+func (r GitRef) resolve(refs []*plumbing.Reference) (plumbing.ReferenceName, error) {
+	if r.IsPattern() {
+		return r.newestTag(refs)
+	}
+
+	for _, candidate := range r.candidates() {
+		for _, ref := range refs {
+			if ref.Name() == candidate {
+				return candidate, nil
 			}
+		}
+	}
 
-			return exec.Command(git, "pull", "origin", "main").Run()
+	return "", Permanent(fmt.Errorf("ref %s not found on the remote", r))
+}
 
+// peeledHash returns the commit a remote ref points to, using the peeled entry of annotated tags
+func peeledHash(refs []*plumbing.Reference, name plumbing.ReferenceName) plumbing.Hash {
+	hash := plumbing.ZeroHash
+	for _, ref := range refs {
+		switch ref.Name() {
+		case name + "^{}":
+			return ref.Hash()
+		case name:
+			hash = ref.Hash()
 		}
-	}()
+	}
+	return hash
+}
+
+// newestTag returns the tag matching the pattern with the highest semantic version.
+// Tags that are not semantic versions are ignored, and so are pre-releases unless the
+// pattern contains a hyphen (v*-rc*).
+func (r GitRef) newestTag(refs []*plumbing.Reference) (plumbing.ReferenceName, error) {
+	prereleases := strings.Contains(string(r), "-")
+
+	var (
+		newest *semver.Version
+		name   plumbing.ReferenceName
+	)
+	for _, ref := range refs {
+		if !ref.Name().IsTag() {
+			continue
+		}
+		if matched, _ := path.Match(string(r), ref.Name().Short()); !matched {
+			continue
+		}
+
+		version, err := semver.NewVersion(ref.Name().Short())
+		if err != nil || version.Prerelease() != "" && !prereleases {
+			continue
+		}
+		if newest == nil || version.GreaterThan(newest) {
+			newest, name = version, ref.Name()
+		}
+	}
+
+	if newest == nil {
+		return "", Permanent(fmt.Errorf("no tag matches %s", r))
+	}
+	return name, nil
+}
+
+// candidates returns the full ref names the ref can stand for, branches first
+func (r GitRef) candidates() []plumbing.ReferenceName {
+	if strings.HasPrefix(string(r), "refs/") {
+		return []plumbing.ReferenceName{plumbing.ReferenceName(r)}
+	}
+	return []plumbing.ReferenceName{plumbing.NewBranchReferenceName(string(r)), plumbing.NewTagReferenceName(string(r))}
+}
+
+// shortName returns the name of the ref without the refs/heads/ or refs/tags/ prefix
+func (r GitRef) shortName() string {
+	return strings.TrimPrefix(strings.TrimPrefix(string(r), "refs/heads/"), "refs/tags/")
+}
+
+// isPermanentStatus reports whether an HTTP status code will not change on retry
+func isPermanentStatus(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 &&
+		statusCode != http.StatusRequestTimeout &&
+		statusCode != http.StatusTooManyRequests
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// remoteTestRepo creates a bare repository with three commits on main, a feature/x branch
+// and tags, and returns its file:// URL with the commits, oldest first
+func remoteTestRepo(t *testing.T) (string, []plumbing.Hash) {
+	t.Helper()
+	root := t.TempDir()
+	workDir, bareDir := filepath.Join(root, "work"), filepath.Join(root, "remote.git")
+
+	repository, err := git.PlainInitWithOptions(workDir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.Main},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := &object.Signature{Name: "Jane", Email: "jane@example.com", When: time.Unix(1700000000, 0)}
+	var commits []plumbing.Hash
+	for _, message := range []string{"first", "second", "third"} {
+		writeFiles(t, workDir, message)
+		if _, err := worktree.Add(message); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := worktree.Commit(message, &git.CommitOptions{Author: signature})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits = append(commits, hash)
+	}
+
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature/x"), commits[0]),
+		plumbing.NewHashReference(plumbing.NewTagReferenceName("v1.0"), commits[0]),
+		plumbing.NewHashReference(plumbing.NewTagReferenceName("v2.0-rc1"), commits[2]),
+		plumbing.NewHashReference(plumbing.NewTagReferenceName("main"), commits[0]),
+	}
+	for _, ref := range refs {
+		if err := repository.Storer.SetReference(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// annotated tag: the remote lists the tag object and its peeled commit
+	if _, err := repository.CreateTag("v1.1", commits[1], &git.CreateTagOptions{Tagger: signature, Message: "v1.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := git.PlainClone(bareDir, true, &git.CloneOptions{URL: workDir, Mirror: true}); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + bareDir, commits
+}
+
+func TestGitProviderCommit(t *testing.T) {
+	gitUrl, commits := remoteTestRepo(t)
+
+	tests := []struct {
+		name string
+		ref  string
+		want plumbing.Hash
+		err  string
+	}{
+		{name: "branch wins over tag of the same name", ref: "main", want: commits[2]},
+		{name: "branch with slash", ref: "feature/x", want: commits[0]},
+		{name: "full tag name", ref: "refs/tags/main", want: commits[0]},
+		{name: "lightweight tag", ref: "v1.0", want: commits[0]},
+		{name: "annotated tag peeled", ref: "v1.1", want: commits[1]},
+		{name: "pattern newest tag without pre-releases", ref: "v*", want: commits[1]},
+		{name: "pattern with pre-releases", ref: "v*-rc*", want: commits[2]},
+		{name: "commit sha", ref: commits[0].String(), want: commits[0]},
+		{name: "missing ref", ref: "missing", err: "ref missing not found on the remote"},
+		{name: "pattern without match", ref: "release-*", err: "no tag matches release-*"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := NewRemoteProvider(&Configurations{Provider: GitProvider, GitUrl: gitUrl})
+
+			commit, err := provider.Commit(test.ref)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				if !errors.As(err, &permanentError{}) {
+					t.Errorf("error %v is not permanent", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if commit.Id != test.want.String() {
+				t.Errorf("got commit %s, want %s", commit.Id, test.want)
+			}
+		})
+	}
+}
+
+func TestGitListRemoteMissingRepository(t *testing.T) {
+	gitUrl := "file://" + filepath.Join(t.TempDir(), "missing.git")
+	provider := NewRemoteProvider(&Configurations{Provider: GitProvider, GitUrl: gitUrl})
+
+	if _, err := provider.Commit("main"); err == nil || !strings.Contains(err.Error(), "failed to list remote refs") {
+		t.Fatalf("got error %v, want a listing error", err)
+	}
+}
+
+// gitTestConfig returns a configuration cloning gitUrl into a temporary directory with the git provider
+func gitTestConfig(t *testing.T, gitUrl string, ref GitRef) *Configurations {
+	t.Helper()
+	return &Configurations{
+		DotfilePath:   t.TempDir(),
+		GitRepository: "dotfiles",
+		GitUrl:        gitUrl,
+		Provider:      GitProvider,
+		Ref:           ref,
+	}
+}
+
+func TestRemoteCommitMatchesCheckout(t *testing.T) {
+	gitUrl, commits := remoteTestRepo(t)
+
+	// the fixture has both a branch and a tag named main
+	tests := []struct {
+		ref  GitRef
+		want plumbing.Hash
+	}{
+		{ref: "main", want: commits[2]},
+		{ref: "refs/heads/main", want: commits[2]},
+		{ref: "refs/tags/main", want: commits[0]},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.ref), func(t *testing.T) {
+			g := Git{gitTestConfig(t, gitUrl, test.ref)}
+			if err := g.CloneOrPullRepository(); err != nil {
+				t.Fatal(err)
+			}
+			assertHead(t, g, test.want)
+		})
+	}
+}
+
+// assertHead fails unless the local clone and the remote are both at want
+func assertHead(t *testing.T, g Git, want plumbing.Hash) {
+	t.Helper()
+	local, err := g.LocalCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := g.RemoteCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.Id != want.String() {
+		t.Errorf("HEAD is %s, want %s", local.Id, want)
+	}
+	if !g.IsSync(local, remote) {
+		t.Errorf("not in sync: local %s, remote %s", local.Id, remote.Id)
+	}
+}
+
+func TestCloneOrPullRepository(t *testing.T) {
+	gitUrl, commits := remoteTestRepo(t)
+
+	tests := []struct {
+		name string
+		ref  GitRef
+		want plumbing.Hash
+	}{
+		{name: "branch", ref: "main", want: commits[2]},
+		{name: "branch with slash", ref: "feature/x", want: commits[0]},
+		{name: "lightweight tag", ref: "v1.0", want: commits[0]},
+		{name: "annotated tag", ref: "v1.1", want: commits[1]},
+		{name: "version pattern", ref: "v*", want: commits[1]},
+		{name: "pinned commit", ref: GitRef(commits[1].String()), want: commits[1]},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := Git{gitTestConfig(t, gitUrl, test.ref)}
+			if err := g.CloneOrPullRepository(); err != nil {
+				t.Fatal(err)
+			}
+			assertHead(t, g, test.want)
+
+			// Pulling again is a no-op
+			if err := g.CloneOrPullRepository(); err != nil {
+				t.Fatal(err)
+			}
+			assertHead(t, g, test.want)
+		})
+	}
+}
+
+func TestCloneOrPullRepositorySwitchesRef(t *testing.T) {
+	gitUrl, commits := remoteTestRepo(t)
+	g := Git{gitTestConfig(t, gitUrl, "main")}
+
+	steps := []struct {
+		ref  GitRef
+		want plumbing.Hash
+	}{
+		{ref: "main", want: commits[2]},
+		{ref: "v1.0", want: commits[0]},
+		{ref: "feature/x", want: commits[0]},
+		{ref: GitRef(commits[1].String()), want: commits[1]},
+		{ref: "v*", want: commits[1]},
+		{ref: "main", want: commits[2]},
+	}
+
+	for _, step := range steps {
+		g.config.Ref = step.ref
+		if err := g.CloneOrPullRepository(); err != nil {
+			t.Fatalf("switching to %s: %v", step.ref, err)
+		}
+		assertHead(t, g, step.want)
+	}
+}
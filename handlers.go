@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/r3labs/sse/v2"
 )
@@ -96,6 +99,155 @@ func (s SyncHandler) Sync(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
+// SoftwareHandler handles HTTP requests for the software of the enhanced config.
+// Installs share the sync mutex, so they run one at a time and never during a sync.
+type SoftwareHandler struct {
+	config *Configurations // Agent configuration locating the dotfiles repository
+	mutex  *sync.Mutex     // Mutex serializing installs and syncs
+}
+
+// SoftwareInfo describes a software entry as returned by GET /software
+type SoftwareInfo struct {
+	Software  string   `json:"software"`
+	Command   string   `json:"command,omitempty"`    // Install command resolved for this platform
+	DependsOn []string `json:"depends_on,omitempty"` // Software that is installed first
+	Installed bool     `json:"installed"`            // Result of the installed check
+}
+
+// NewSoftwareHandler creates a new SoftwareHandler with the provided dependencies
+func NewSoftwareHandler(config *Configurations, mutex *sync.Mutex) *SoftwareHandler {
+	return &SoftwareHandler{
+		config,
+		mutex,
+	}
+}
+
+// enhancedConfig parses the enhanced config of the dotfiles repository
+func (s SoftwareHandler) enhancedConfig() (*EnhancedConfig, error) {
+	return ParseEnhancedConfig(filepath.Join(s.config.RepoPath(), DotfileConfigName))
+}
+
+// List handles GET /software, returning every entry with its resolved command and installed state
+func (s SoftwareHandler) List(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	config, err := s.enhancedConfig()
+	if err != nil {
+		writer.WriteHeader(http.StatusNotFound)
+		writeResponse(writer, err.Error(), nil)
+		return
+	}
+
+	software := make([]SoftwareInfo, 0, len(config.Dotfiles))
+	for _, entry := range config.Dotfiles {
+		command, _ := entry.GetInstallCommand()
+		software = append(software, SoftwareInfo{
+			Software:  entry.Software,
+			Command:   command,
+			DependsOn: entry.DependsOn,
+			Installed: entry.IsInstalled(),
+		})
+	}
+
+	writeResponse(writer, "Successful", map[string]any{
+		"platform": GetPlatform(),
+		"software": software,
+	})
+}
+
+// Check handles GET /software/check, returning the version status of every entry with a
+// version requirement; unsatisfied lists the entries whose installed version is not supported
+func (s SoftwareHandler) Check(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	if request.Method != http.MethodGet {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	config, err := s.enhancedConfig()
+	if err != nil {
+		writer.WriteHeader(http.StatusNotFound)
+		writeResponse(writer, err.Error(), nil)
+		return
+	}
+
+	statuses := config.CheckVersions()
+	unsatisfied := []string{}
+	for _, status := range statuses {
+		if !status.Satisfied {
+			unsatisfied = append(unsatisfied, status.Software)
+		}
+	}
+
+	writeResponse(writer, "Successful", map[string]any{
+		"versions":    statuses,
+		"unsatisfied": unsatisfied,
+	})
+}
+
+// Install handles POST /software/install?names=a,b and streams InstallEvents via Server-Sent Events.
+// Without names every entry is installed. The last event carries the InstallReport.
+// Requests arriving while another install or a sync runs get a queued event and wait.
+func (s SoftwareHandler) Install(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var names []string
+	for _, value := range request.URL.Query()["names"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	config, err := s.enhancedConfig()
+	if err != nil {
+		writer.WriteHeader(http.StatusNotFound)
+		writeResponse(writer, err.Error(), nil)
+		return
+	}
+
+	send := func(data any) {
+		v, _ := json.Marshal(data)
+		_, _ = fmt.Fprintf(writer, "data: %v\n\n", string(v))
+		writer.(http.Flusher).Flush() // Send the event immediately
+	}
+
+	installer := NewInstaller(config, func(event InstallEvent) { send(event) })
+	installer.Executor.LogDir = filepath.Join(s.config.ConfigPath, installLogDir)
+	if _, _, err := installer.Plan(names...); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		writeResponse(writer, err.Error(), nil)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+
+	if !s.mutex.TryLock() {
+		send(InstallEvent{Status: InstallQueued, Message: "waiting for a running install or sync"})
+		s.mutex.Lock()
+	}
+	defer s.mutex.Unlock()
+
+	report, err := installer.Install(names...)
+	if err != nil {
+		send(map[string]any{"done": true, "error": err.Error()})
+		return
+	}
+
+	send(map[string]any{"done": true, "report": report})
+}
+
 // writeResponse writes a JSON response with a message and payload
 func writeResponse(writer io.Writer, msg string, payload any) {
 	body := make(map[string]any, 2)
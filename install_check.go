@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// installCheckTimeout bounds how long an installed-check probe may run
+const installCheckTimeout = 10 * time.Second
+
+// InstallCheck describes how to find out whether software is already installed.
+// In YAML it is either a shell command (`check: command -v nvim`) or a command
+// whose output must match a regular expression (`check: {command: nvim --version, pattern: "NVIM v0\\.1[0-9]"}`).
+type InstallCheck struct {
+	Command string `yaml:"command"`           // Shell command that must exit successfully
+	Pattern string `yaml:"pattern,omitempty"` // Regular expression the command output must match
+}
+
+// UnmarshalYAML accepts a command string or a command/pattern map
+func (c *InstallCheck) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Command = node.Value
+		return nil
+	}
+
+	type plain InstallCheck
+	return node.Decode((*plain)(c))
+}
+
+// Run executes the check and reports whether it passed
+func (c *InstallCheck) Run() (bool, error) {
+	output, err := probe(c.Command)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return false, err
+	}
+	if err != nil {
+		return false, nil
+	}
+
+	if c.Pattern == "" {
+		return true, nil
+	}
+
+	pattern, err := regexp.Compile(c.Pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid check pattern %q: %w", c.Pattern, err)
+	}
+
+	return pattern.Match(output), nil
+}
+
+// probe runs a shell command with the install check timeout and returns its combined output
+func probe(command string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), installCheckTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Env = sandboxEnv(defaultEnvAllowlist, nil)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%q timed out after %s: %w", command, installCheckTimeout, ctx.Err())
+	}
+	if err != nil {
+		return output, fmt.Errorf("%q failed: %w", command, err)
+	}
+
+	return output, nil
+}
+
+// IsInstalled reports whether the software of an entry is already installed.
+// Without a check, the software name is looked up on PATH; for releases,
+// every binary must be on PATH or in ~/.local/bin.
+func (d *DotfileEntry) IsInstalled() bool {
+	if d.Check == nil || d.Check.Command == "" {
+		if release, _ := d.GetRelease(); release != nil {
+			for _, bin := range release.Bin {
+				name := path.Base(bin)
+				if _, err := exec.LookPath(name); err == nil {
+					continue
+				}
+				if _, err := os.Stat(filepath.Join(DefaultBinDir(), name)); err != nil {
+					return false
+				}
+			}
+			return true
+		}
+
+		_, err := exec.LookPath(d.Software)
+		return err == nil
+	}
+
+	installed, err := d.Check.Run()
+	if err != nil {
+		Error("Installed check failed for", d.Software+":", err.Error())
+		return false
+	}
+
+	return installed
+}
@@ -3,14 +3,18 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 )
 
-// InstallSoftware reads the config and installs required software
-// InstallSoftware reads the config and installs required software
-func InstallSoftware(configPath string, interactive bool) error {
+// InstallSoftware reads the config and installs required software.
+// Software is installed in dependency order (depends_on) and anything that
+// depends on a failed package is skipped. Returns an error if any package failed.
+func InstallSoftware(configPath string, interactive bool, executor Executor) error {
 	config, err := ParseEnhancedConfig(configPath)
 	if err != nil {
 		return fmt.Errorf("failed to parse config: %w", err)
@@ -19,16 +23,22 @@ func InstallSoftware(configPath string, interactive bool) error {
 	platform := GetPlatform()
 	fmt.Printf("Detected platform: %s\n\n", platform)
 
-	installCommands := config.GetInstallCommands()
-	if len(installCommands) == 0 {
+	installer := NewInstaller(config, PrintInstallEvents(os.Stdout))
+	installer.Executor = executor
+	entries, installCommands, err := installer.Plan()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
 		fmt.Printf("No software installation commands found for platform: %s\n", platform)
 		return nil
 	}
 
-	fmt.Printf("Found %d software packages to install:\n\n", len(installCommands))
+	fmt.Printf("Found %d software packages to install:\n\n", len(entries))
 
-	for software, command := range installCommands {
-		fmt.Printf("  - %s: %s\n", software, command)
+	for _, entry := range entries {
+		fmt.Printf("  - %s: %s\n", entry.Software, installCommands[entry.Software])
 	}
 	fmt.Println()
 
@@ -44,72 +54,98 @@ func InstallSoftware(configPath string, interactive bool) error {
 		}
 	}
 
-	fmt.Println("\nStarting installation...\n")
-
-	successCount := 0
-	failedPackages := []string{}
-
-	for software, command := range installCommands {
-		fmt.Printf("Installing %s...\n", software)
-
-		// Execute installation command
-		cmd := exec.Command("bash", "-c", command)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("  ✗ Failed to install %s: %v\n\n", software, err)
-			failedPackages = append(failedPackages, software)
-		} else {
-			fmt.Printf("  ✓ Successfully installed %s\n\n", software)
-			successCount++
-		}
-	}
-
-	// Summary
-	fmt.Println("========================================")
-	fmt.Printf("Installation complete: %d succeeded, %d failed\n", successCount, len(failedPackages))
+	fmt.Print("\nStarting installation...\n\n")
 
-	if len(failedPackages) > 0 {
-		fmt.Println("\nFailed packages:")
-		for _, pkg := range failedPackages {
-			fmt.Printf("  - %s\n", pkg)
-		}
+	report, err := installer.Install()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	PrintInstallReport(os.Stdout, report)
+	return report.Err()
 }
 
-// InstallSpecificSoftware installs only specific software from the config
-func InstallSpecificSoftware(configPath string, softwareNames []string) error {
+// InstallSpecificSoftware installs only specific software from the config,
+// together with the software they depend on. Returns an error if any package failed.
+func InstallSpecificSoftware(configPath string, softwareNames []string, executor Executor) error {
 	config, err := ParseEnhancedConfig(configPath)
 	if err != nil {
 		return fmt.Errorf("failed to parse config: %w", err)
 	}
 
-	installCommands := config.GetInstallCommands()
-
+	var known []string
 	for _, software := range softwareNames {
-		command, exists := installCommands[software]
-		if !exists {
+		if !slices.Contains(config.GetSoftwareList(), software) {
 			fmt.Printf("Warning: %s not found in config\n", software)
 			continue
 		}
+		known = append(known, software)
+	}
 
-		fmt.Printf("Installing %s...\n", software)
+	if len(known) == 0 {
+		return nil
+	}
 
-		cmd := exec.Command("bash", "-c", command)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+	installer := NewInstaller(config, PrintInstallEvents(os.Stdout))
+	installer.Executor = executor
+	report, err := installer.Install(known...)
+	if err != nil {
+		return err
+	}
 
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("  ✗ Failed to install %s: %v\n", software, err)
-		} else {
-			fmt.Printf("  ✓ Successfully installed %s\n", software)
+	PrintInstallReport(os.Stdout, report)
+	return report.Err()
+}
+
+// PrintInstallEvents returns an InstallListener writing human readable progress to out
+func PrintInstallEvents(out io.Writer) InstallListener {
+	return func(event InstallEvent) {
+		switch event.Status {
+		case InstallStarted:
+			fmt.Fprintf(out, "Installing %s...\n", event.Software)
+		case InstallOutput:
+			fmt.Fprintln(out, event.Message)
+		case InstallInstalled:
+			fmt.Fprintf(out, "  ✓ Successfully installed %s\n\n", event.Software)
+		case InstallFailed:
+			fmt.Fprintf(out, "  ✗ Failed to install %s: %s\n\n", event.Software, event.Message)
+		case InstallSkipped:
+			fmt.Fprintf(out, "Skipping %s: %s\n\n", event.Software, event.Message)
 		}
 	}
+}
 
-	return nil
+// PrintInstallReport writes the summary of an installation run to out
+func PrintInstallReport(out io.Writer, report *InstallReport) {
+	installed := report.Software(InstallInstalled)
+	skipped := report.Software(InstallSkipped)
+	failed := report.Software(InstallFailed)
+
+	fmt.Fprintln(out, "========================================")
+	fmt.Fprintf(out, "Installation complete: %d installed, %d skipped, %d failed (%s)\n",
+		len(installed), len(skipped), len(failed), report.Duration.Round(time.Millisecond))
+
+	if len(failed) > 0 {
+		fmt.Fprintln(out, "\nFailed packages:")
+		for _, result := range report.Results {
+			if result.Status == InstallFailed {
+				fmt.Fprintf(out, "  - %s (exit code %d)\n", result.Software, result.ExitCode)
+			}
+		}
+	}
+
+	if len(skipped) > 0 {
+		fmt.Fprintln(out, "\nSkipped packages:")
+		for _, result := range report.Results {
+			if result.Status == InstallSkipped {
+				fmt.Fprintf(out, "  - %s (%s)\n", result.Software, result.Reason)
+			}
+		}
+	}
+
+	if report.LogFile != "" {
+		fmt.Fprintf(out, "\nFull output: %s\n", report.LogFile)
+	}
 }
 
 // ListSoftware lists all software defined in the config
@@ -129,35 +165,86 @@ func ListSoftware(configPath string) error {
 	return nil
 }
 
+// CheckSoftwareVersions prints the installed version of every entry with a version
+// requirement and returns an error if any of them does not satisfy its constraint
+func CheckSoftwareVersions(configPath string) error {
+	config, err := ParseEnhancedConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	statuses := config.CheckVersions()
+	if len(statuses) == 0 {
+		fmt.Println("No software with a version constraint in config")
+		return nil
+	}
+
+	var unsatisfied []string
+	for _, status := range statuses {
+		switch {
+		case status.Error != "":
+			fmt.Printf("  ✗ %s: %s\n", status.Software, status.Error)
+		case status.Satisfied:
+			fmt.Printf("  ✓ %s %s satisfies %s\n", status.Software, status.Version, status.Constraint)
+		default:
+			fmt.Printf("  ✗ %s %s does not satisfy %s\n", status.Software, status.Version, status.Constraint)
+		}
+
+		if !status.Satisfied {
+			unsatisfied = append(unsatisfied, status.Software)
+		}
+	}
+
+	if len(unsatisfied) > 0 {
+		return fmt.Errorf("unsupported versions: %s", strings.Join(unsatisfied, ", "))
+	}
+	return nil
+}
+
 // ShowPlatformInfo displays platform-specific installation commands for all software
 func ShowPlatformInfo(configPath string) error {
-	config, err := ParseEnhancedConfig(configPath)
+	config, err := readEnhancedConfig(configPath)
 	if err != nil {
 		return fmt.Errorf("failed to parse config: %w", err)
 	}
 
-	currentPlatform := GetPlatform()
-	platforms := []string{"linux", "darwin", "windows", "all"}
+	currentPlatform := CurrentPlatform()
 
-	fmt.Printf("Current platform: %s\n\n", currentPlatform)
+	fmt.Printf("Current platform: %s (matches %s)\n\n", currentPlatform, strings.Join(currentPlatform.Keys(), ", "))
 	fmt.Println("Platform-specific installation commands:")
-	fmt.Println("==========================================\n")
-
-	for _, entry := range config.Dotfiles {
-		fmt.Printf("%s:\n", entry.Software)
-
-		switch v := entry.Install.(type) {
-		case string:
-			fmt.Printf("  all: %s\n", v)
-		case map[string]interface{}:
-			for _, platform := range platforms {
-				if cmd, ok := v[platform]; ok {
-					marker := ""
-					if platform == currentPlatform || platform == "all" {
-						marker = " ← current"
-					}
-					fmt.Printf("  %s: %s%s\n", platform, cmd, marker)
-				}
+	fmt.Print("==========================================\n\n")
+
+	if catalog, err := Recipes(); err == nil {
+		fmt.Printf("Recipe catalog: version %d (%d recipes)\n\n", catalog.Version, len(catalog.Recipes))
+	}
+
+	manager, _ := DetectPackageManager()
+	for i := range config.Dotfiles {
+		entry := &config.Dotfiles[i]
+		if entry.Recipe != "" {
+			fmt.Printf("%s (recipe %s):\n", entry.Software, entry.Recipe)
+		} else {
+			fmt.Printf("%s:\n", entry.Software)
+		}
+
+		// Local commands first, then the catalog commands they don't override
+		source := entry.installSource(currentInstallTarget())
+		local := entry.installOptions(manager, currentPlatform)
+		var catalog []installOption
+		if entry.recipe != nil {
+			catalog = entry.recipe.installOptions(manager, currentPlatform)
+		}
+
+		for _, option := range local {
+			origin := ""
+			if slices.ContainsFunc(catalog, option.sameKey) {
+				origin = " (overrides catalog)"
+			}
+			option.print(source == entry, origin)
+		}
+		for _, option := range catalog {
+			if !slices.ContainsFunc(local, option.sameKey) {
+				option.print(source == entry.recipe, " (catalog)")
 			}
 		}
 		fmt.Println()
@@ -165,3 +252,89 @@ func ShowPlatformInfo(configPath string) error {
 
 	return nil
 }
+
+// installOption is a package list or an install command of an entry, as shown by ShowPlatformInfo
+type installOption struct {
+	packages bool   // Whether this is a package list rather than an install command
+	key      string // Package manager or platform key
+	value    string
+	current  bool // Whether this option applies on the current platform
+}
+
+// installOptions returns the package lists and install commands of an entry, sorted by key
+func (d *DotfileEntry) installOptions(manager *PackageManager, platform Platform) []installOption {
+	var options []installOption
+
+	names := make([]string, 0, len(d.Packages))
+	for name := range d.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		packages := d.Packages[name]
+		options = append(options, installOption{
+			packages: true,
+			key:      name,
+			value:    strings.Join(packages, " "),
+			current:  manager != nil && slices.Equal(d.Packages.Packages(manager), packages),
+		})
+	}
+
+	switch v := d.Install.(type) {
+	case string:
+		options = append(options, installOption{key: "all", value: v})
+	case map[string]interface{}:
+		if _, ok := v[releaseKey]; ok {
+			options = append(options, installOption{key: "all", value: describeInstall(v), current: true})
+			break
+		}
+
+		_, current, _ := platform.Resolve(v)
+		platforms := make([]string, 0, len(v))
+		for key := range v {
+			platforms = append(platforms, key)
+		}
+		sort.Strings(platforms)
+
+		for _, key := range platforms {
+			options = append(options, installOption{key: key, value: describeInstall(v[key]), current: key == current})
+		}
+	}
+
+	return options
+}
+
+// sameKey reports whether two options are for the same package manager or platform
+func (o installOption) sameKey(other installOption) bool {
+	return o.packages == other.packages && o.key == other.key
+}
+
+// print writes the option, marking it as current when its entry provides the command on this platform
+func (o installOption) print(source bool, origin string) {
+	marker := ""
+	if source && o.current {
+		marker = " ← current"
+		if manager, err := DetectPackageManager(); err == nil && o.packages {
+			marker += " (" + manager.Name + ")"
+		}
+	}
+
+	if o.packages {
+		fmt.Printf("  packages %s: %s%s%s\n", o.key, o.value, origin, marker)
+	} else {
+		fmt.Printf("  %s: %s%s%s\n", o.key, o.value, origin, marker)
+	}
+}
+
+// describeInstall returns a command, or the URL template of a release, for display
+func describeInstall(value interface{}) string {
+	if v, ok := value.(map[string]interface{}); ok {
+		if release, ok := v[releaseKey]; ok {
+			if spec, err := parseReleaseSpec(release); err == nil {
+				return "release " + spec.URL
+			}
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
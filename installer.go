@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Install statuses of a package in an InstallReport and of InstallEvents
+const (
+	InstallQueued    = "queued"    // The install waits for another install or sync to finish
+	InstallStarted   = "started"   // Installation of the package has begun
+	InstallOutput    = "output"    // A line of installer output
+	InstallInstalled = "installed" // The package was installed
+	InstallSkipped   = "skipped"   // The package was already installed or a dependency was not installed
+	InstallFailed    = "failed"    // The install command failed
+	InstallRemoved   = "removed"   // The package was uninstalled and its files deleted
+)
+
+// PackageResult is the outcome of installing a single software entry
+type PackageResult struct {
+	Software string        `json:"software"`         // Software name from the config
+	Status   string        `json:"status"`           // installed, skipped or failed
+	Reason   string        `json:"reason,omitempty"` // Why the package was skipped or failed
+	Command  string        `json:"command"`          // Command that was run
+	Batch    []string      `json:"batch,omitempty"`  // Software installed by the same package manager command
+	ExitCode int           `json:"exit_code"`        // Exit code of the command, -1 if it could not be started
+	Duration time.Duration `json:"duration"`         // Time spent running the command, in nanoseconds
+	Stdout   string        `json:"stdout"`           // Captured standard output
+	Stderr   string        `json:"stderr"`           // Captured standard error
+}
+
+// InstallReport is the structured result of an installation run
+type InstallReport struct {
+	Platform string          `json:"platform"`           // Platform the commands were resolved for
+	Results  []PackageResult `json:"results"`            // One result per software entry, in install order
+	Duration time.Duration   `json:"duration"`           // Total duration, in nanoseconds
+	LogFile  string          `json:"log_file,omitempty"` // File with the full output of the run
+}
+
+// InstallEvent reports installation progress to listeners
+type InstallEvent struct {
+	Software string `json:"software"`          // Software the event is about
+	Status   string `json:"status"`            // started, output, installed, skipped or failed
+	Message  string `json:"message,omitempty"` // Output line, or reason for skipped and failed
+	Progress int    `json:"progress"`          // Percentage of entries processed (0-100)
+}
+
+// alreadyInstalled is the reason of packages skipped because their installed check passed
+const alreadyInstalled = "already installed"
+
+// InstallListener receives installation progress events
+type InstallListener func(event InstallEvent)
+
+// Installer installs the software defined in an enhanced configuration.
+// It runs install commands in dependency order, batches package manager installs,
+// skips software that is already installed and reports progress to listeners.
+type Installer struct {
+	Executor  Executor         // Runs the install commands
+	Releases  ReleaseInstaller // Installs `install: {release: ...}` entries
+	RepoDir   string           // Repository the files are deployed from; Remove only deletes files matching it
+	StateDir  string           // Agent config directory whose agent-state.json records removals, empty to not record
+	config    *EnhancedConfig
+	listeners []InstallListener
+	mutex     sync.Mutex // Serializes listener calls from the stdout and stderr copiers
+}
+
+// NewInstaller creates an Installer for a configuration, running commands with the DefaultExecutor
+func NewInstaller(config *EnhancedConfig, listeners ...InstallListener) *Installer {
+	return &Installer{
+		Executor:  DefaultExecutor,
+		Releases:  NewReleaseInstaller(),
+		config:    config,
+		listeners: listeners,
+	}
+}
+
+// Plan returns the entries that Install would process, in install order, with
+// their install command. Entries without a command for this platform are left out.
+func (i *Installer) Plan(software ...string) ([]DotfileEntry, map[string]string, error) {
+	entries, err := i.config.InstallOrder(software...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commands := i.config.GetInstallCommands()
+	planned := make([]DotfileEntry, 0, len(entries))
+	for _, entry := range entries {
+		if _, ok := commands[entry.Software]; ok {
+			planned = append(planned, entry)
+		}
+	}
+
+	return planned, commands, nil
+}
+
+// Install installs the given software, or every entry of the config when none is given,
+// together with the software they depend on. The returned error is only set when the
+// installation could not be planned (unknown software, dependency cycle); failed
+// packages are reported in the InstallReport.
+func (i *Installer) Install(software ...string) (*InstallReport, error) {
+	start := time.Now()
+	entries, commands, err := i.Plan(software...)
+	if err != nil {
+		return nil, err
+	}
+
+	executorRun, err := i.Executor.start()
+	if err != nil {
+		return nil, err
+	}
+	defer executorRun.Close()
+
+	run := &installRun{
+		installer: i,
+		executor:  executorRun,
+		commands:  commands,
+		total:     len(entries),
+		failed:    make(map[string]bool),
+		report:    &InstallReport{Platform: GetPlatform(), LogFile: executorRun.LogFile()},
+	}
+
+	for _, entry := range entries {
+		if entry.IsInstalled() {
+			run.record(PackageResult{Software: entry.Software, Status: InstallSkipped, Reason: alreadyInstalled})
+			continue
+		}
+
+		// Consecutive package manager installs are batched into a single command
+		if len(entry.SystemPackages()) > 0 {
+			run.batch = append(run.batch, entry)
+			continue
+		}
+
+		run.flush()
+		run.install(entry)
+	}
+	run.flush()
+
+	run.report.Duration = time.Since(start)
+	return run.report, nil
+}
+
+// emit sends an event to every listener
+func (i *Installer) emit(event InstallEvent) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	for _, listener := range i.listeners {
+		listener(event)
+	}
+}
+
+// installRun holds the state of a single Installer.Install call
+type installRun struct {
+	installer *Installer
+	executor  *executorRun
+	commands  map[string]string
+	total     int
+	done      int
+	failed    map[string]bool // Software that was not installed, for skipping dependents
+	batch     []DotfileEntry  // Entries waiting to be installed with the package manager
+	report    *InstallReport
+}
+
+// progress returns the percentage of processed entries
+func (r *installRun) progress() int {
+	if r.total == 0 {
+		return 100
+	}
+	return r.done * 100 / r.total
+}
+
+// record adds a result to the report and notifies listeners
+func (r *installRun) record(result PackageResult) {
+	if result.Status == InstallFailed {
+		r.failed[result.Software] = true
+	}
+
+	r.done++
+	r.report.Results = append(r.report.Results, result)
+	r.installer.emit(InstallEvent{
+		Software: result.Software,
+		Status:   result.Status,
+		Message:  result.Reason,
+		Progress: r.progress(),
+	})
+}
+
+// skipped records entries with a dependency that was not installed, and reports whether it did
+func (r *installRun) skipped(entry DotfileEntry) bool {
+	if dependency := failedDependency(entry, r.failed); dependency != "" {
+		r.failed[entry.Software] = true
+		r.record(PackageResult{
+			Software: entry.Software,
+			Status:   InstallSkipped,
+			Reason:   "dependency " + dependency + " was not installed",
+		})
+		return true
+	}
+	return false
+}
+
+// install runs the install command of a single entry
+func (r *installRun) install(entry DotfileEntry) {
+	if r.skipped(entry) {
+		return
+	}
+
+	var result PackageResult
+	if release, err := entry.GetRelease(); err != nil || release != nil {
+		result = r.installRelease(entry, release, err)
+	} else {
+		result = r.execute(r.commands[entry.Software], entry)
+	}
+	result.Software = entry.Software
+	r.record(result)
+}
+
+// flush installs the pending package manager entries with a single command.
+// If the batch fails, the entries are installed one by one to find the failures.
+func (r *installRun) flush() {
+	var (
+		pending  []DotfileEntry
+		names    []string
+		packages []string
+	)
+	for _, entry := range r.batch {
+		if r.skipped(entry) {
+			continue
+		}
+		pending = append(pending, entry)
+		names = append(names, entry.Software)
+		packages = append(packages, entry.SystemPackages()...)
+	}
+	r.batch = nil
+
+	if len(pending) < 2 {
+		for _, entry := range pending {
+			r.install(entry)
+		}
+		return
+	}
+
+	manager, err := DetectPackageManager()
+	if err != nil {
+		for _, entry := range pending {
+			r.install(entry)
+		}
+		return
+	}
+
+	command, err := manager.Command(packages)
+	if err != nil {
+		for _, entry := range pending {
+			r.install(entry)
+		}
+		return
+	}
+
+	result := r.execute(command, pending...)
+	if result.Status != InstallInstalled {
+		for _, entry := range pending {
+			r.install(entry)
+		}
+		return
+	}
+
+	for _, entry := range pending {
+		entryResult := result
+		entryResult.Software = entry.Software
+		entryResult.Batch = names
+		r.record(entryResult)
+	}
+}
+
+// execute runs the install command of one or more entries, capturing its output and
+// streaming it to listeners. A batch gets the longest timeout and the env of all entries.
+func (r *installRun) execute(script string, entries ...DotfileEntry) PackageResult {
+	command := execCommand{Script: script, Env: make(map[string]string)}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Software)
+		command.Timeout = max(command.Timeout, entry.Timeout)
+		for name, value := range entry.Env {
+			command.Env[name] = value
+		}
+	}
+	command.Name = strings.Join(names, ", ")
+
+	r.installer.emit(InstallEvent{Software: command.Name, Status: InstallStarted, Message: script, Progress: r.progress()})
+
+	var stdout, stderr bytes.Buffer
+	output := func(line string) {
+		r.installer.emit(InstallEvent{Software: command.Name, Status: InstallOutput, Message: line, Progress: r.progress()})
+	}
+	stdoutLines, stderrLines := newLineWriter(output), newLineWriter(output)
+
+	start := time.Now()
+	exitCode, err := r.executor.Run(command, io.MultiWriter(&stdout, stdoutLines), io.MultiWriter(&stderr, stderrLines))
+	stdoutLines.Flush()
+	stderrLines.Flush()
+
+	result := PackageResult{
+		Status:   InstallInstalled,
+		Command:  script,
+		ExitCode: exitCode,
+		Duration: time.Since(start),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+	}
+
+	if err != nil {
+		result.Status = InstallFailed
+		result.Reason = err.Error()
+	}
+
+	return result
+}
+
+// installRelease downloads and installs the release of an entry, streaming progress to listeners
+func (r *installRun) installRelease(entry DotfileEntry, release *ResolvedRelease, err error) PackageResult {
+	result := PackageResult{Status: InstallFailed, Command: r.commands[entry.Software], ExitCode: 1}
+	if err != nil {
+		result.Reason = err.Error()
+		return result
+	}
+
+	r.installer.emit(InstallEvent{Software: entry.Software, Status: InstallStarted, Message: result.Command, Progress: r.progress()})
+
+	timeout := entry.Timeout
+	if timeout == 0 {
+		timeout = r.installer.Executor.Timeout
+	}
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	var stdout bytes.Buffer
+	lines := newLineWriter(func(line string) {
+		r.installer.emit(InstallEvent{Software: entry.Software, Status: InstallOutput, Message: line, Progress: r.progress()})
+	})
+
+	r.executor.logf("=== %s: %s\n", entry.Software, result.Command)
+	start := time.Now()
+	_, err = r.installer.Releases.Install(ctx, release, io.MultiWriter(&stdout, lines, r.executor.logWriter()))
+	lines.Flush()
+
+	result.Duration = time.Since(start)
+	result.Stdout = stdout.String()
+	if err != nil {
+		result.Reason = err.Error()
+		r.executor.logf("=== %s failed after %s: %v\n\n", entry.Software, result.Duration.Round(time.Millisecond), err)
+		return result
+	}
+
+	r.executor.logf("=== %s succeeded after %s\n\n", entry.Software, result.Duration.Round(time.Millisecond))
+	result.Status, result.ExitCode = InstallInstalled, 0
+	return result
+}
+
+// Software returns the names of the software with the given status
+func (r *InstallReport) Software(status string) []string {
+	var names []string
+	for _, result := range r.Results {
+		if result.Status == status {
+			names = append(names, result.Software)
+		}
+	}
+	return names
+}
+
+// NotInstalled returns the software that failed or was skipped because a dependency was not installed
+func (r *InstallReport) NotInstalled() []string {
+	var names []string
+	for _, result := range r.Results {
+		if result.Status == InstallFailed || result.Status == InstallSkipped && result.Reason != alreadyInstalled {
+			names = append(names, result.Software)
+		}
+	}
+	return names
+}
+
+// Err returns an error listing the failed packages, or nil if nothing failed
+func (r *InstallReport) Err() error {
+	if failed := r.Software(InstallFailed); len(failed) > 0 {
+		return fmt.Errorf("failed to install: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
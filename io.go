@@ -1,8 +1,10 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -44,6 +46,16 @@ func Error(v ...string) {
 func ConsoleSyncConsumer(event SyncEvent) {
 	data := event.Data
 	status := "===completed"
+	if data.Output != "" {
+		fmt.Printf("\n  | %s\n", data.Output)
+		return
+	}
+
+	if data.Attempt > 0 {
+		fmt.Printf("===retrying (%d/%d)", data.Attempt, data.MaxAttempts)
+		return
+	}
+
 	if data.Progress == 0 {
 		Info("Sync triggered===(0%)")
 		time.Sleep(time.Second)
@@ -64,3 +76,37 @@ func ConsoleSyncConsumer(event SyncEvent) {
 		fmt.Printf("%s\n", status)
 	}
 }
+
+// lineWriter is an io.Writer that passes every complete line written to it to a callback.
+// It is used to stream command output as sync events.
+type lineWriter struct {
+	emit   func(line string)
+	buffer []byte
+}
+
+// newLineWriter creates a lineWriter calling emit for every line
+func newLineWriter(emit func(line string)) *lineWriter {
+	return &lineWriter{emit: emit}
+}
+
+// Write buffers p and emits every complete line
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buffer = append(w.buffer, p...)
+	for {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(strings.TrimRight(string(w.buffer[:i]), "\r"))
+		w.buffer = w.buffer[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits any incomplete last line
+func (w *lineWriter) Flush() {
+	if len(w.buffer) > 0 {
+		w.emit(string(w.buffer))
+		w.buffer = nil
+	}
+}
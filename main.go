@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,36 +14,123 @@ import (
 
 func main() {
 	var (
-		rootCmd       = cobra.Command{}
-		mux           = http.NewServeMux()
-		sseServer     = sse.New()
+		rootCmd       = cobra.Command{Use: "dotfile-agent"}
 		port          = rootCmd.Flags().StringP("port", "p", DefaultPort, "HTTP port to run on")
 		webhookUrl    = rootCmd.Flags().StringP("webhook", "w", "", "git webhook url")
-		dotFilePath   = rootCmd.Flags().StringP("dotfile-path", "d", "", "path to dotfile directory")
-		configDir     = rootCmd.Flags().StringP("config-dir", "c", "", "path to config directory")
-		gitUrl        = rootCmd.Flags().StringP("git-url", "g", "", "github api url")
-		gitApiBaseUrl = rootCmd.Flags().StringP("git-api-base-url", "b", "https://api.github.com", "github api url")
+		strategy      = rootCmd.Flags().StringP("strategy", "s", AutoStrategy, "sync strategy: "+strings.Join(Strategies(), "|"))
+		ref           = rootCmd.Flags().String("ref", DefaultRef, "git ref to track: branch, tag, full commit SHA or tag pattern such as 'v*'")
+		dotFilePath   = rootCmd.PersistentFlags().StringP("dotfile-path", "d", "", "path to dotfile directory")
+		configDir     = rootCmd.PersistentFlags().StringP("config-dir", "c", "", "path to config directory")
+		gitUrl        = rootCmd.PersistentFlags().StringP("git-url", "g", "", "github api url")
+		sshKey        = rootCmd.PersistentFlags().String("ssh-key", "", "private key for SSH git urls, its passphrase read from "+sshKeyPassphraseEnv+" (default: SSH agent)")
+		provider      = rootCmd.PersistentFlags().String("provider", AutoProvider, "git hosting provider: "+strings.Join(Providers(), "|"))
+		gitApiBaseUrl = rootCmd.PersistentFlags().StringP("git-api-base-url", "b", "", "git provider api url (default: derived from the provider and git url)")
+		retry         = DefaultRetryPolicy
+		install       = DefaultInstallPolicy
 	)
 
-	if err := rootCmd.Execute(); err != nil {
-		Error(err.Error())
-		return
+	rootCmd.Flags().IntVar(&retry.Attempts, "retry-attempts", DefaultRetryPolicy.Attempts, "attempts for git and HTTP operations")
+	rootCmd.Flags().DurationVar(&retry.BaseDelay, "retry-base-delay", DefaultRetryPolicy.BaseDelay, "delay before the first retry, doubled on every retry")
+	rootCmd.Flags().DurationVar(&retry.MaxDelay, "retry-max-delay", DefaultRetryPolicy.MaxDelay, "maximum delay between retries")
+	rootCmd.Flags().Float64Var(&retry.Jitter, "retry-jitter", DefaultRetryPolicy.Jitter, "fraction of each delay to randomize (0-1)")
+	rootCmd.Flags().StringVar(&install.AutoInstall, "auto-install", "", "install software during syncs: never|new|always (default: auto_install of "+DotfileConfigName+")")
+	rootCmd.Flags().StringVar(&install.Confirmation, "install-confirmation", DefaultInstallPolicy.Confirmation, "confirmation before installing during syncs: auto|prompt")
+
+	rootCmd.Run = func(cmd *cobra.Command, args []string) {
+		config, err := InitializeConfigurations(*dotFilePath, *webhookUrl, *port, *configDir, *gitUrl, *sshKey, *provider, *gitApiBaseUrl, *ref, *strategy, retry, install)
+		if err != nil {
+			Error(err.Error())
+			return
+		}
+
+		runAgent(config)
 	}
 
-	config, err := InitializeConfigurations(*dotFilePath, *webhookUrl, *port, *configDir, *gitUrl, *gitApiBaseUrl)
-	if err != nil {
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "unstow [package...]",
+		Short: "Remove the links of stow packages from the home directory",
+		Run: func(cmd *cobra.Command, args []string) {
+			config, err := InitializeConfigurations(*dotFilePath, "", "", *configDir, *gitUrl, *sshKey, *provider, *gitApiBaseUrl, DefaultRef, StowStrategy, DefaultRetryPolicy, DefaultInstallPolicy)
+			if err != nil {
+				Error(err.Error())
+				return
+			}
+
+			git := &Git{config}
+			syncer := NewStowSyncer(config, NewBrokerNotifier(git), &sync.Mutex{}, git).(stowSyncer)
+			if err := syncer.Unstow(args...); err != nil {
+				Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	})
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate-config [path]",
+		Short: "Convert a legacy dotfile-config.yaml to the enhanced format",
+		Args:  cobra.MaximumNArgs(1),
+	}
+	migrateOutput := migrateCmd.Flags().StringP("output", "o", "", "file to write the migrated config to (default: overwrite the input)")
+	migrateYes := migrateCmd.Flags().BoolP("yes", "y", false, "write without asking for confirmation")
+	migrateDryRun := migrateCmd.Flags().Bool("dry-run", false, "only print the diff")
+	migrateCmd.Run = func(cmd *cobra.Command, args []string) {
+		configPath := DotfileConfigName
+		if len(args) > 0 {
+			configPath = args[0]
+		}
+
+		if err := MigrateConfig(configPath, *migrateOutput, *migrateYes, *migrateDryRun); err != nil {
+			Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(softwareCommand(configDir))
+
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show the install commands, file targets and entries another machine would get",
+	}
+	current := CurrentHost()
+	planFile := planCmd.Flags().StringP("file", "f", DotfileConfigName, "path to the enhanced config")
+	planPlatform := planCmd.Flags().String("platform", current.Platform.String(), "platform of the machine, as os[/distro][/arch]")
+	planHostname := planCmd.Flags().String("hostname", current.Hostname, "hostname of the machine")
+	planPackageManager := planCmd.Flags().String("package-manager", "", "package manager of the machine (default: the usual one of the platform)")
+	planCmd.Run = func(cmd *cobra.Command, args []string) {
+		host := Host{Platform: ParsePlatform(*planPlatform), Hostname: *planHostname}
+		if err := ShowPlan(*planFile, host, *planPackageManager); err != nil {
+			Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	rootCmd.AddCommand(planCmd)
+
+	if err := rootCmd.Execute(); err != nil {
 		Error(err.Error())
 		return
 	}
+}
+
+// runAgent starts the webhook listener, the polling loop and the HTTP server.
+func runAgent(config *Configurations) {
+	var (
+		mux       = http.NewServeMux()
+		sseServer = sse.New()
+	)
 
 	git := &Git{config}
 	brokerNotifier := NewBrokerNotifier(git)
 	mutex := &sync.Mutex{}
-	syncer := NewEnhancedSyncer(config, brokerNotifier, mutex, git)
+	syncer, err := NewSyncer(config.Strategy, config, brokerNotifier, mutex, git)
+	if err != nil {
+		Error(err.Error())
+		return
+	}
 	syncHandler := NewSyncHandler(&syncer, git, sseServer)
+	softwareHandler := NewSoftwareHandler(config, mutex)
 	brokerNotifier.RegisterStream()
 	httpClient := &http.Client{}
-	sseClient := &SseClient{Syncer: syncer}
+	sseClient := &SseClient{Syncer: syncer, Ref: config.Ref}
 	deadline := 5 * time.Second
 
 	var resp *http.Response
@@ -52,10 +140,11 @@ func main() {
 			for {
 				select {
 				case <-t.C:
-					ctx, _ := context.WithDeadline(context.Background(), time.Now().Add(deadline))
-					req, _ := http.NewRequestWithContext(ctx, http.MethodGet, *webhookUrl, nil)
+					ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(deadline))
+					req, _ := http.NewRequestWithContext(ctx, http.MethodGet, config.WebHook, nil)
 					response, err := httpClient.Do(req)
 					if err != nil {
+						cancel()
 						Error(err.Error())
 					} else {
 						resp = response
@@ -102,7 +191,7 @@ func main() {
 			select {
 			case <-ticker.C:
 				localCommit, _ := git.LocalCommit()
-				remoteCommit, _ := git.RemoteCommit()
+				remoteCommit, _ := git.RemoteCommitWithRetry()
 				isSync := git.IsSync(localCommit, remoteCommit)
 				if !isSync {
 					Infoln("Triggering Automatic Sync")
@@ -112,11 +201,14 @@ func main() {
 		}
 	}()
 
-	Infoln("Listening on webhook url", *webhookUrl)
+	Infoln("Listening on webhook url", config.WebHook)
 
 	// register handlers
 	mux.HandleFunc("/sync", syncHandler.Sync)
-	Infoln("Server started on port", *port)
-	Error(http.ListenAndServe(":"+*port, mux).Error())
+	mux.HandleFunc("/software", softwareHandler.List)
+	mux.HandleFunc("/software/install", softwareHandler.Install)
+	mux.HandleFunc("/software/check", softwareHandler.Check)
+	Infoln("Server started on port", config.Port)
+	Error(http.ListenAndServe(":"+config.Port, mux).Error())
 	os.Exit(1)
 }
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// knownSoftware maps well-known dotfile names to the software they configure
+var knownSoftware = map[string]string{
+	".bashrc":           "bash",
+	".bash_profile":     "bash",
+	".bash_aliases":     "bash",
+	".bash_logout":      "bash",
+	".profile":          "bash",
+	".zshrc":            "zsh",
+	".zshenv":           "zsh",
+	".zprofile":         "zsh",
+	".zsh_aliases":      "zsh",
+	"zsh":               "zsh",
+	".oh-my-zsh":        "oh-my-zsh",
+	"fish":              "fish",
+	".vimrc":            "vim",
+	".vim":              "vim",
+	".gvimrc":           "vim",
+	"nvim":              "neovim",
+	".tmux.conf":        "tmux",
+	"tmux":              "tmux",
+	".gitconfig":        "git",
+	".gitignore_global": "git",
+	".gitmessage":       "git",
+	"git":               "git",
+	"alacritty":         "alacritty",
+	"alacritty.yml":     "alacritty",
+	"alacritty.toml":    "alacritty",
+	"kitty":             "kitty",
+	"starship.toml":     "starship",
+	".wezterm.lua":      "wezterm",
+	"wezterm":           "wezterm",
+	".npmrc":            "npm",
+	".yarnrc":           "yarn",
+	".cargo":            "rust",
+	".docker":           "docker",
+	".aws":              "awscli",
+	".kube":             "kubectl",
+	".ssh":              "ssh",
+	".gnupg":            "gnupg",
+	".emacs":            "emacs",
+	".emacs.d":          "emacs",
+	"i3":                "i3",
+	"sway":              "sway",
+	"hypr":              "hyprland",
+	"polybar":           "polybar",
+	"rofi":              "rofi",
+	"htop":              "htop",
+	"lazygit":           "lazygit",
+}
+
+// MigrateLegacyConfig converts the nested legacy configuration format
+// (`home: [.bashrc, .config: nvim;]`) into the enhanced `dotfiles:` format.
+// Files are grouped by the software inferred from their names, in the order they appear.
+func MigrateLegacyConfig(data []byte) (*EnhancedConfig, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("legacy config must be a mapping of target directories")
+	}
+
+	root := document.Content[0]
+	for i := 0; i < len(root.Content); i += 2 {
+		if root.Content[i].Value == "dotfiles" {
+			return nil, errors.New("config is already in the enhanced format")
+		}
+	}
+
+	config := &EnhancedConfig{}
+	index := make(map[string]int) // software name -> position in config.Dotfiles
+
+	addFile := func(target, file string) {
+		software := inferSoftware(file)
+		i, ok := index[software]
+		if !ok {
+			config.Dotfiles = append(config.Dotfiles, DotfileEntry{Software: software})
+			i = len(config.Dotfiles) - 1
+			index[software] = i
+		}
+
+		config.Dotfiles[i].Files = append(config.Dotfiles[i].Files, FileSpec{
+			Path:   file,
+			Target: target,
+		})
+	}
+
+	var walk func(node *yaml.Node, base string)
+	walk = func(node *yaml.Node, base string) {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			if base == "" && key == "strategy" {
+				continue
+			}
+
+			target := path.Join(base, key)
+			switch value.Kind {
+			case yaml.SequenceNode:
+				for _, item := range value.Content {
+					switch item.Kind {
+					case yaml.ScalarNode:
+						addFile(target, item.Value)
+					case yaml.MappingNode:
+						walk(item, target)
+					}
+				}
+			case yaml.MappingNode:
+				walk(value, target)
+			case yaml.ScalarNode:
+				// `.config: nvim;` is accepted as a single entry list
+				if value.Value != "" {
+					addFile(target, value.Value)
+				}
+			}
+		}
+	}
+	walk(root, "")
+
+	if len(config.Dotfiles) == 0 {
+		return nil, errors.New("no dotfiles found in legacy config")
+	}
+
+	return config, nil
+}
+
+// inferSoftware guesses the software a dotfile belongs to from its name.
+// Well-known names are looked up first, otherwise the name is stripped of its
+// leading dot, directory suffix, extension and "rc" suffix (.npmrc -> npm).
+func inferSoftware(file string) string {
+	name := path.Base(strings.TrimSuffix(file, directorySuffix))
+	if software, ok := knownSoftware[name]; ok {
+		return software
+	}
+
+	software := strings.TrimPrefix(name, ".")
+	if ext := path.Ext(software); ext != "" && ext != software {
+		software = strings.TrimSuffix(software, ext)
+	}
+	if strings.HasSuffix(software, "rc") && len(software) > 2 {
+		software = strings.TrimSuffix(software, "rc")
+	}
+
+	return software
+}
+
+// MarshalEnhancedConfig renders an enhanced configuration as YAML
+func MarshalEnhancedConfig(config *EnhancedConfig) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// MigrateConfig converts a legacy dotfile-config.yaml into the enhanced format.
+// The diff between both files is printed before anything is written; unless
+// assumeYes is set, the user is asked to confirm. With dryRun only the diff is printed.
+func MigrateConfig(configPath string, outputPath string, assumeYes bool, dryRun bool) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config, err := MigrateLegacyConfig(data)
+	if err != nil {
+		return err
+	}
+
+	migrated, err := MarshalEnhancedConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to render enhanced config: %w", err)
+	}
+
+	if outputPath == "" {
+		outputPath = configPath
+	}
+
+	fmt.Print(unifiedDiff(string(data), string(migrated), configPath, outputPath))
+	fmt.Println()
+
+	if dryRun {
+		return nil
+	}
+
+	if !assumeYes {
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Printf("Write migrated config to %s? (y/n): ", outputPath)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+
+		if response != "y" && response != "yes" {
+			fmt.Println("Migration cancelled")
+			return nil
+		}
+	}
+
+	if err := os.WriteFile(outputPath, migrated, 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	fmt.Printf("Migrated %d software entries to %s\n", len(config.Dotfiles), outputPath)
+	return nil
+}
+
+// unifiedDiff returns a line based diff of two texts in unified format.
+// The whole file is shown as a single hunk, which is enough for config files.
+func unifiedDiff(a, b, nameA, nameB string) string {
+	linesA := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	linesB := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(linesA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(linesB)+1)
+	}
+	for i := len(linesA) - 1; i >= 0; i-- {
+		for j := len(linesB) - 1; j >= 0; j-- {
+			if linesA[i] == linesB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	fmt.Fprintf(&diff, "--- %s\n+++ %s\n", nameA, nameB)
+	fmt.Fprintf(&diff, "@@ -1,%d +1,%d @@\n", len(linesA), len(linesB))
+
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		switch {
+		case i < len(linesA) && j < len(linesB) && linesA[i] == linesB[j]:
+			diff.WriteString(" " + linesA[i] + "\n")
+			i++
+			j++
+		case i < len(linesA) && (j == len(linesB) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff.WriteString("-" + linesA[i] + "\n")
+			i++
+		default:
+			diff.WriteString("+" + linesB[j] + "\n")
+			j++
+		}
+	}
+
+	return diff.String()
+}
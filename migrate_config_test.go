@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const legacyTestConfig = "home:\n  - .bashrc\n  - .config: nvim;\n"
+
+// captureStdout returns everything fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+
+	fn()
+	writer.Close()
+	return <-output
+}
+
+// migrateTestConfig writes the legacy test config and returns its path and the output path
+func migrateTestConfig(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, DotfileConfigName)
+	if err := os.WriteFile(configPath, []byte(legacyTestConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configPath, filepath.Join(dir, "migrated.yaml")
+}
+
+func TestMigrateConfigDryRun(t *testing.T) {
+	for _, inPlace := range []bool{false, true} {
+		configPath, outputPath := migrateTestConfig(t)
+		if inPlace {
+			outputPath = ""
+		}
+
+		var err error
+		output := captureStdout(t, func() {
+			err = MigrateConfig(configPath, outputPath, false, true)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing is written: the config is unchanged and no output file exists
+		assertContent(t, configPath, legacyTestConfig)
+		if outputPath != "" {
+			if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+				t.Errorf("dry run created %s", outputPath)
+			}
+		}
+		if strings.Contains(output, "Migrated") || strings.Contains(output, "?") {
+			t.Errorf("dry run wrote or prompted:\n%s", output)
+		}
+
+		// The diff removes the legacy lines and adds the entries with their targets
+		if outputPath == "" {
+			outputPath = configPath
+		}
+		for _, line := range []string{
+			"--- " + configPath,
+			"+++ " + outputPath,
+			"-home:",
+			"-  - .config: nvim;",
+			"+  - software: bash",
+			"+        target: home",
+			"+  - software: neovim",
+			"+        target: home/.config",
+		} {
+			if !strings.Contains(output, line+"\n") {
+				t.Errorf("diff does not contain %q:\n%s", line, output)
+			}
+		}
+	}
+}
+
+func TestMigrateConfigWrite(t *testing.T) {
+	configPath, outputPath := migrateTestConfig(t)
+
+	var err error
+	output := captureStdout(t, func() {
+		err = MigrateConfig(configPath, outputPath, true, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, configPath, legacyTestConfig)
+	if !strings.Contains(output, "+  - software: neovim\n") || !strings.Contains(output, "Migrated 2 software entries") {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+
+	config, err := ParseEnhancedConfig(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Dotfiles) != 2 || config.Dotfiles[1].Software != "neovim" || config.Dotfiles[1].Files[0].Target != "home/.config" {
+		t.Errorf("migrated config %+v", config.Dotfiles)
+	}
+}
@@ -4,8 +4,11 @@ import "time"
 
 // Commit represents a Git commit with its ID and timestamp
 type Commit struct {
-	Id   string `json:"id"`          // Git commit SHA hash
-	Time string `json:"commit_time"` // Commit timestamp in RFC3339 format
+	Id         string `json:"id"`                    // Git commit SHA hash
+	Time       string `json:"commit_time"`           // Commit timestamp in RFC3339 format
+	AuthorName string `json:"author_name,omitempty"` // Name of the commit author
+	Message    string `json:"message,omitempty"`     // Full commit message
+	Ref        string `json:"ref,omitempty"`         // Branch or tag the commit was looked up for, e.g. the newest release tag
 }
 
 // GitWebHookCommitResponse represents the payload received from Git webhook events.
@@ -28,8 +31,10 @@ type GitHttpCommitResponse struct {
 	Sha    string `json:"sha"` // Commit SHA hash
 	Commit struct {
 		Author struct {
+			Name string `json:"name"` // Author name
 			Date string `json:"date"` // Author date in ISO 8601 format
 		} `json:"author"`
+		Message string `json:"message"` // Full commit message
 	} `json:"commit"`
 }
 
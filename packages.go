@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultPackageKey is the PackageSpec key used for every package manager without its own key
+const defaultPackageKey = "default"
+
+// PackageManager describes how to install packages non-interactively with a system package manager
+type PackageManager struct {
+	Name       string   // Key used in `packages:` specs (apt, dnf, brew, ...)
+	Binary     string   // Executable looked up on PATH to detect the package manager
+	Platforms  []string // Operating systems the package manager is used on
+	Privileged bool     // Whether installing requires root
+	Update     string   // Command refreshing the package index, run once before installing
+	Install    string   // Install command, package names are appended
+	Aliases    []string // Other spec keys whose package names work with this manager
+}
+
+// packageManagers lists the supported package managers in detection order
+var packageManagers = []PackageManager{
+	{Name: "apt", Binary: "apt-get", Platforms: []string{"linux"}, Privileged: true,
+		Update: "apt-get update -q", Install: "env DEBIAN_FRONTEND=noninteractive apt-get install -y -q"},
+	{Name: "dnf", Binary: "dnf", Platforms: []string{"linux"}, Privileged: true,
+		Install: "dnf install -y", Aliases: []string{"yum"}},
+	{Name: "yum", Binary: "yum", Platforms: []string{"linux"}, Privileged: true,
+		Install: "yum install -y", Aliases: []string{"dnf"}},
+	// No -y: refreshing the sync database without upgrading (-Syu) is an unsupported partial upgrade
+	{Name: "pacman", Binary: "pacman", Platforms: []string{"linux"}, Privileged: true,
+		Install: "pacman -S --needed --noconfirm"},
+	{Name: "zypper", Binary: "zypper", Platforms: []string{"linux"}, Privileged: true,
+		Install: "zypper --non-interactive install"},
+	{Name: "apk", Binary: "apk", Platforms: []string{"linux"}, Privileged: true,
+		Install: "apk add --no-cache"},
+	{Name: "brew", Binary: "brew", Platforms: []string{"darwin", "linux"},
+		Install: "env HOMEBREW_NO_AUTO_UPDATE=1 brew install"},
+	{Name: "port", Binary: "port", Platforms: []string{"darwin"}, Privileged: true,
+		Install: "port -N install"},
+	{Name: "pkg", Binary: "pkg", Platforms: []string{"freebsd"}, Privileged: true,
+		Install: "pkg install -y"},
+	{Name: "winget", Binary: "winget", Platforms: []string{"windows"},
+		Install: "winget install --silent --accept-package-agreements --accept-source-agreements"},
+	{Name: "choco", Binary: "choco", Platforms: []string{"windows"},
+		Install: "choco install -y"},
+	{Name: "scoop", Binary: "scoop", Platforms: []string{"windows"},
+		Install: "scoop install"},
+}
+
+// platformPackageManagers maps distributions and operating systems to their usual package manager,
+// used to preview the commands of another machine
+var platformPackageManagers = map[string]string{
+	"debian": "apt", "ubuntu": "apt", "linuxmint": "apt", "pop": "apt", "raspbian": "apt",
+	"fedora": "dnf", "rhel": "dnf", "centos": "dnf", "rocky": "dnf", "almalinux": "dnf", "amzn": "dnf",
+	"arch": "pacman", "manjaro": "pacman", "endeavouros": "pacman",
+	"opensuse": "zypper", "opensuse-leap": "zypper", "opensuse-tumbleweed": "zypper", "suse": "zypper", "sles": "zypper",
+	"alpine": "apk",
+	"darwin": "brew", "freebsd": "pkg", "windows": "winget",
+}
+
+// PackageSpec maps package manager names to the packages to install with them.
+// In YAML it can be a map (`{apt: zsh, brew: [zsh, zsh-completions]}`), or a
+// single name or list used for every package manager (`packages: zsh`).
+type PackageSpec map[string]PackageList
+
+// PackageList is a list of package names that can be written as a single string in YAML
+type PackageList []string
+
+// UnmarshalYAML accepts a package name or a list of package names
+func (l *PackageList) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*l = strings.Fields(node.Value)
+		return nil
+	case yaml.SequenceNode:
+		var names []string
+		if err := node.Decode(&names); err != nil {
+			return err
+		}
+		*l = names
+		return nil
+	default:
+		return fmt.Errorf("line %d: packages must be a name or a list of names", node.Line)
+	}
+}
+
+// UnmarshalYAML accepts a map of package managers, or a package name or list used for every package manager
+func (p *PackageSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		var list PackageList
+		if err := node.Decode(&list); err != nil {
+			return err
+		}
+		*p = PackageSpec{defaultPackageKey: list}
+		return nil
+	}
+
+	var spec map[string]PackageList
+	if err := node.Decode(&spec); err != nil {
+		return err
+	}
+	*p = spec
+	return nil
+}
+
+// Packages returns the package names to install with a package manager, or nil if none are defined
+func (p PackageSpec) Packages(manager *PackageManager) []string {
+	if manager == nil {
+		return nil
+	}
+
+	for _, key := range append([]string{manager.Name}, manager.Aliases...) {
+		if names, ok := p[key]; ok {
+			return names
+		}
+	}
+
+	return p[defaultPackageKey]
+}
+
+// detectedPackageManager caches the result of DetectPackageManager
+var detectedPackageManager = sync.OnceValues(func() (*PackageManager, error) {
+	for _, manager := range packageManagers {
+		if !slices.Contains(manager.Platforms, runtime.GOOS) {
+			continue
+		}
+
+		if _, err := exec.LookPath(manager.Binary); err == nil {
+			m := manager
+			return &m, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no supported package manager found for platform: %s", runtime.GOOS)
+})
+
+// DetectPackageManager returns the first supported package manager available on PATH
+func DetectPackageManager() (*PackageManager, error) {
+	return detectedPackageManager()
+}
+
+// PackageManagerFor returns the package manager usually found on a platform, without
+// looking at this machine. It is known for macOS, FreeBSD, Windows and Linux
+// platforms naming their distribution.
+func PackageManagerFor(platform Platform) (*PackageManager, error) {
+	for _, key := range append(append([]string{platform.Distro}, platform.DistroLike...), platform.OS) {
+		if name, ok := platformPackageManagers[key]; ok && key != "" {
+			return LookupPackageManager(name)
+		}
+	}
+
+	return nil, fmt.Errorf("no package manager known for platform: %s", platform)
+}
+
+// LookupPackageManager returns the supported package manager with a name
+func LookupPackageManager(name string) (*PackageManager, error) {
+	for _, manager := range packageManagers {
+		if manager.Name == name {
+			m := manager
+			return &m, nil
+		}
+	}
+
+	names := make([]string, 0, len(packageManagers))
+	for _, manager := range packageManagers {
+		names = append(names, manager.Name)
+	}
+	return nil, fmt.Errorf("unknown package manager %s, supported: %s", name, strings.Join(names, ", "))
+}
+
+// sudoPrefix runs a command as root without prompting: install commands have no terminal
+// to type a password into, so sudo fails at once instead of waiting for one
+const sudoPrefix = "sudo -n "
+
+// Command builds a non-interactive shell command installing all packages at once.
+// The package index is refreshed first when the manager needs it, and commands are
+// prefixed with sudo -n when the manager requires root and the agent is not running as root.
+func (m PackageManager) Command(packages []string) (string, error) {
+	if len(packages) == 0 {
+		return "", errors.New("no packages to install")
+	}
+
+	prefix := ""
+	if m.Privileged && runtime.GOOS != "windows" && os.Geteuid() != 0 {
+		if _, err := exec.LookPath("sudo"); err != nil {
+			return "", fmt.Errorf("%s requires root privileges and sudo is not available", m.Name)
+		}
+		prefix = sudoPrefix
+	}
+
+	return m.command(packages, prefix), nil
+}
+
+// PreviewCommand builds the install command as a non-root user on another machine would
+// run it, using sudo when the manager requires root, without looking at this machine
+func (m PackageManager) PreviewCommand(packages []string) (string, error) {
+	if len(packages) == 0 {
+		return "", errors.New("no packages to install")
+	}
+
+	prefix := ""
+	if m.Privileged && !slices.Contains(m.Platforms, "windows") {
+		prefix = sudoPrefix
+	}
+
+	return m.command(packages, prefix), nil
+}
+
+// command joins the update and install commands for the packages
+func (m PackageManager) command(packages []string, prefix string) string {
+	quoted := make([]string, 0, len(packages))
+	for _, name := range packages {
+		quoted = append(quoted, shellQuote(name))
+	}
+
+	install := prefix + m.Install + " " + strings.Join(quoted, " ")
+	if m.Update == "" {
+		return install
+	}
+
+	return prefix + m.Update + " && " + install
+}
+
+// shellQuote quotes a word for bash unless it only contains safe characters
+func shellQuote(word string) string {
+	safe := word != "" && strings.IndexFunc(word, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.+:/=@", r))
+	}) == -1
+	if safe {
+		return word
+	}
+
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// planHomeDir stands for the home directory of the planned machine in file targets
+const planHomeDir = "~"
+
+// HostPlan is what a host would get from a config: its install commands, the
+// targets of its files and the entries its `when` conditions leave out
+type HostPlan struct {
+	Host           Host
+	PackageManager string // Package manager the commands are built for, empty if none is known
+	Installs       []PlannedInstall
+	Files          []PlannedFile
+	Excluded       []ExcludedEntry
+}
+
+// PlannedInstall is the install command a host would run for an entry
+type PlannedInstall struct {
+	Software string
+	Command  string // Install command, or the release download
+	Recipe   string // Recipe providing the command, empty if the entry provides it
+	Error    string // Why the entry cannot be installed on the host
+}
+
+// PlannedFile is a file of the repository and where a host would deploy it
+type PlannedFile struct {
+	Software   string
+	Path       string // Path in the repository, directories end with ;
+	Target     string // Destination, under ~ for the home directory
+	Constraint string // Version constraint the file is only deployed for (skip_files), empty if always deployed
+}
+
+// ExcludedEntry is an entry left out by its `when` condition
+type ExcludedEntry struct {
+	Software string
+	Reason   string
+}
+
+// PlanFor renders what a host would get from a config. Package manager commands are built
+// for manager, nil if the host has none. Nothing is probed on this machine: installed
+// software, versions and the files present in the repository are not looked at.
+func PlanFor(config *EnhancedConfig, host Host, manager *PackageManager) (*HostPlan, error) {
+	plan := &HostPlan{Host: host}
+	if manager != nil {
+		plan.PackageManager = manager.Name
+	}
+
+	for _, entry := range config.Dotfiles {
+		if ok, reason := entry.When.Matches(host); !ok {
+			plan.Excluded = append(plan.Excluded, ExcludedEntry{Software: entry.Software, Reason: reason})
+		}
+	}
+
+	entries, err := config.ForHost(host).InstallOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	target := previewInstallTarget(host.Platform, manager)
+	for _, entry := range entries {
+		if entry.Install != nil || len(entry.Packages) > 0 || entry.recipe != nil {
+			install := PlannedInstall{Software: entry.Software}
+			if source := entry.installSource(target); source != &entry {
+				install.Recipe = entry.Recipe
+			}
+
+			command, err := entry.installCommand(target)
+			if err != nil {
+				install.Error = err.Error()
+			} else {
+				install.Command = command
+			}
+			plan.Installs = append(plan.Installs, install)
+		}
+
+		for _, fileSpec := range entry.Files {
+			file := PlannedFile{
+				Software: entry.Software,
+				Path:     fileSpec.Path,
+				Target:   fileSpec.Destination(planHomeDir),
+			}
+			if entry.Version != nil && entry.Version.SkipFiles {
+				file.Constraint = entry.Version.Constraint
+			}
+			plan.Files = append(plan.Files, file)
+		}
+	}
+
+	return plan, nil
+}
+
+// PrintHostPlan writes a plan in a human readable form to out
+func PrintHostPlan(out io.Writer, plan *HostPlan) {
+	hostname := plan.Host.Hostname
+	if hostname == "" {
+		hostname = "any host"
+	}
+	fmt.Fprintf(out, "Plan for %s on %s (matches %s)\n", hostname, plan.Host.Platform, strings.Join(plan.Host.Platform.Keys(), ", "))
+	if plan.PackageManager != "" {
+		fmt.Fprintf(out, "Package manager: %s\n", plan.PackageManager)
+	} else {
+		fmt.Fprintln(out, "Package manager: none")
+	}
+
+	fmt.Fprintf(out, "\nInstall commands, in install order (%d):\n", len(plan.Installs))
+	for _, install := range plan.Installs {
+		switch {
+		case install.Error != "":
+			fmt.Fprintf(out, "  ✗ %s: %s\n", install.Software, install.Error)
+		case install.Recipe != "":
+			fmt.Fprintf(out, "  %s: %s (recipe %s)\n", install.Software, install.Command, install.Recipe)
+		default:
+			fmt.Fprintf(out, "  %s: %s\n", install.Software, install.Command)
+		}
+	}
+
+	fmt.Fprintf(out, "\nFiles (%d):\n", len(plan.Files))
+	for _, file := range plan.Files {
+		constraint := ""
+		if file.Constraint != "" {
+			constraint = " (if version " + file.Constraint + ")"
+		}
+		source, isDir := strings.CutSuffix(file.Path, ";")
+		target := file.Target
+		if isDir {
+			source, target = source+"/", target+"/"
+		}
+		fmt.Fprintf(out, "  %s: %s -> %s%s\n", file.Software, source, target, constraint)
+	}
+
+	if len(plan.Excluded) > 0 {
+		fmt.Fprintf(out, "\nExcluded entries (%d):\n", len(plan.Excluded))
+		for _, excluded := range plan.Excluded {
+			fmt.Fprintf(out, "  - %s: %s\n", excluded.Software, excluded.Reason)
+		}
+	}
+}
+
+// ShowPlan prints the plan of a config for a host, using the package manager usually
+// found on its platform unless one is named
+func ShowPlan(configPath string, host Host, packageManager string) error {
+	config, err := readEnhancedConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	var manager *PackageManager
+	if packageManager != "" {
+		if manager, err = LookupPackageManager(packageManager); err != nil {
+			return err
+		}
+	} else {
+		manager, _ = PackageManagerFor(host.Platform)
+	}
+
+	plan, err := PlanFor(config, host, manager)
+	if err != nil {
+		return err
+	}
+
+	PrintHostPlan(os.Stdout, plan)
+	return nil
+}
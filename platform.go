@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// osReleasePaths are the locations of the os-release file, in lookup order
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// Platform identifies a machine for platform-specific configuration.
+// It is written as os[/distro][/arch], e.g. linux/ubuntu/arm64 or darwin/arm64.
+type Platform struct {
+	OS         string   // Operating system (runtime.GOOS)
+	Distro     string   // Linux distribution ID from /etc/os-release (ubuntu, fedora, arch, ...)
+	DistroLike []string // Distributions the distro derives from (ID_LIKE), most specific first
+	Arch       string   // CPU architecture (runtime.GOARCH)
+}
+
+// Host identifies the machine a config is evaluated for: its platform and hostname
+type Host struct {
+	Platform Platform
+	Hostname string
+}
+
+// CurrentHost returns this machine. The hostname is empty if it cannot be determined.
+func CurrentHost() Host {
+	hostname, _ := os.Hostname()
+	return Host{Platform: CurrentPlatform(), Hostname: hostname}
+}
+
+// currentPlatform caches the result of CurrentPlatform
+var currentPlatform = sync.OnceValue(func() Platform {
+	platform := Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if platform.OS == "linux" {
+		platform.Distro, platform.DistroLike = readOSRelease()
+	}
+	return platform
+})
+
+// CurrentPlatform returns the platform of this machine
+func CurrentPlatform() Platform {
+	return currentPlatform()
+}
+
+// ParsePlatform parses a platform written as os[/distro][/arch].
+// The architecture is recognised by name, so linux/arm64 and linux/ubuntu are both valid.
+func ParsePlatform(value string) Platform {
+	parts := strings.Split(normalizePlatformKey(value), "/")
+	platform := Platform{OS: parts[0]}
+
+	for _, part := range parts[1:] {
+		if isArch(part) {
+			platform.Arch = part
+		} else if platform.Distro == "" {
+			platform.Distro = part
+		}
+	}
+
+	return platform
+}
+
+// String returns the most specific key of the platform
+func (p Platform) String() string {
+	return p.Keys()[0]
+}
+
+// Keys returns the keys matching this platform, from the most specific to the least:
+// os/distro/arch, os/distro, os/like/arch, os/like, os/arch, os and all.
+func (p Platform) Keys() []string {
+	var keys []string
+	add := func(parts ...string) {
+		for _, part := range parts {
+			if part == "" {
+				return
+			}
+		}
+		keys = append(keys, strings.Join(parts, "/"))
+	}
+
+	for _, distro := range append([]string{p.Distro}, p.DistroLike...) {
+		add(p.OS, distro, p.Arch)
+		add(p.OS, distro)
+	}
+	add(p.OS, p.Arch)
+	add(p.OS)
+	keys = append(keys, "all")
+
+	return keys
+}
+
+// Resolve returns the value of the most specific key matching this platform.
+// Keys are compared case-insensitively and common architecture aliases
+// (x86_64, aarch64) are accepted.
+func (p Platform) Resolve(values map[string]interface{}) (interface{}, string, bool) {
+	normalized := make(map[string]string, len(values))
+	for key := range values {
+		normalized[normalizePlatformKey(key)] = key
+	}
+
+	for _, key := range p.Keys() {
+		if original, ok := normalized[key]; ok {
+			return values[original], original, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// normalizePlatformKey lower-cases a platform key and maps architecture aliases to Go names
+func normalizePlatformKey(key string) string {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(key)), "/")
+	for i, part := range parts {
+		switch part {
+		case "x86_64", "x64":
+			parts[i] = "amd64"
+		case "aarch64":
+			parts[i] = "arm64"
+		case "macos", "osx":
+			parts[i] = "darwin"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// isArch reports whether a platform key part is a CPU architecture
+func isArch(part string) bool {
+	switch part {
+	case "386", "amd64", "arm", "arm64", "loong64", "mips", "mips64", "mips64le", "mipsle",
+		"ppc64", "ppc64le", "riscv64", "s390x":
+		return true
+	}
+	return false
+}
+
+// readOSRelease returns the ID and ID_LIKE values of the os-release file
+func readOSRelease() (string, []string) {
+	for _, p := range osReleasePaths {
+		file, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		defer file.Close()
+
+		var (
+			id   string
+			like []string
+		)
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			key, value, found := strings.Cut(scanner.Text(), "=")
+			if !found {
+				continue
+			}
+			value = strings.ToLower(strings.Trim(value, `"'`))
+
+			switch key {
+			case "ID":
+				id = value
+			case "ID_LIKE":
+				like = strings.Fields(value)
+			}
+		}
+
+		return id, like
+	}
+
+	return "", nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// recipesYAML is the bundled recipe catalog
+//
+//go:embed recipes.yaml
+var recipesYAML []byte
+
+// RecipeCatalog is the versioned catalog of built-in software recipes
+type RecipeCatalog struct {
+	Version int                     `yaml:"version"` // Catalog version, bumped on incompatible recipe changes
+	Recipes map[string]DotfileEntry `yaml:"recipes"` // Recipes by name
+}
+
+// recipeCatalog caches the result of Recipes
+var recipeCatalog = sync.OnceValues(func() (*RecipeCatalog, error) {
+	var catalog RecipeCatalog
+	if err := yaml.Unmarshal(recipesYAML, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse recipe catalog: %w", err)
+	}
+	return &catalog, nil
+})
+
+// Recipes returns the bundled recipe catalog
+func Recipes() (*RecipeCatalog, error) {
+	return recipeCatalog()
+}
+
+// Names returns the names of all recipes, sorted
+func (c *RecipeCatalog) Names() []string {
+	names := make([]string, 0, len(c.Recipes))
+	for name := range c.Recipes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyRecipes links every entry with a `recipe:` to its catalog recipe
+func (c *EnhancedConfig) applyRecipes() error {
+	for i := range c.Dotfiles {
+		entry := &c.Dotfiles[i]
+		if entry.Recipe == "" {
+			continue
+		}
+
+		catalog, err := Recipes()
+		if err != nil {
+			return err
+		}
+
+		recipe, ok := catalog.Recipes[entry.Recipe]
+		if !ok {
+			return fmt.Errorf("unknown recipe %q for %s (available: %v)", entry.Recipe, entry.Software, catalog.Names())
+		}
+		entry.applyRecipe(&recipe)
+	}
+	return nil
+}
+
+// applyRecipe fills the settings the entry leaves empty from a recipe. Install commands and
+// packages are not copied: the recipe is used when the entry has none for the platform.
+func (d *DotfileEntry) applyRecipe(recipe *DotfileEntry) {
+	d.recipe = recipe
+	if d.Software == "" {
+		d.Software = d.Recipe
+	}
+	if d.Check == nil {
+		d.Check = recipe.Check
+	}
+	if d.Version == nil {
+		d.Version = recipe.Version
+	}
+	if d.Uninstall == nil {
+		d.Uninstall = recipe.Uninstall
+	}
+	if d.DependsOn == nil {
+		d.DependsOn = recipe.DependsOn
+	}
+	if d.Files == nil {
+		d.Files = recipe.Files
+	}
+}
+
+// installSource returns the entry whose install settings apply on a target:
+// the entry itself when it has an install command or packages for it, otherwise its recipe
+func (d *DotfileEntry) installSource(target installTarget) *DotfileEntry {
+	if d.recipe == nil {
+		return d
+	}
+	if _, err := d.resolveInstall(target.platform); err == nil {
+		return d
+	}
+	if len(d.Packages.Packages(target.manager)) > 0 {
+		return d
+	}
+	return d.recipe
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// releaseKey is the key of the `install:` map describing a release download
+const releaseKey = "release"
+
+// Archive formats of ReleaseSpec.Extract
+const (
+	ExtractTarGz  = "tar.gz"  // gzip compressed tarball (.tar.gz, .tgz)
+	ExtractTarBz2 = "tar.bz2" // bzip2 compressed tarball (.tar.bz2, .tbz2)
+	ExtractTar    = "tar"     // Uncompressed tarball
+	ExtractZip    = "zip"     // Zip archive
+	ExtractGz     = "gz"      // Single gzip compressed binary
+	ExtractNone   = "none"    // The download is the binary itself
+)
+
+// ReleaseSpec describes software installed from a release archive:
+//
+//	install:
+//	  release:
+//	    url: https://github.com/BurntSushi/ripgrep/releases/download/{{.Version}}/ripgrep-{{.Version}}-{{.Arch}}-{{.OS}}.tar.gz
+//	    version: 14.1.0
+//	    arch: {amd64: x86_64, arm64: aarch64}
+//	    os: {linux: unknown-linux-musl, darwin: apple-darwin}
+//	    sha256: {linux/amd64: 4cf9f2..., darwin/arm64: 24ad76...}
+//	    bin: ripgrep-*/rg
+//
+// URL and bin are templates receiving {{.OS}}, {{.Arch}} and {{.Version}}.
+type ReleaseSpec struct {
+	URL     string            `yaml:"url"`               // Download URL template
+	Version string            `yaml:"version,omitempty"` // Version available to templates
+	SHA256  ReleaseChecksum   `yaml:"sha256"`            // Expected checksum of the download
+	Extract string            `yaml:"extract,omitempty"` // Archive format, default: inferred from the URL
+	Bin     PackageList       `yaml:"bin"`               // Paths or globs of the binaries in the archive
+	OS      map[string]string `yaml:"os,omitempty"`      // Names of operating systems in templates (linux: unknown-linux-gnu)
+	Arch    map[string]string `yaml:"arch,omitempty"`    // Names of architectures in templates (amd64: x86_64)
+}
+
+// ReleaseChecksum maps platform keys to SHA-256 checksums.
+// In YAML it is a single checksum or a map of platform keys (linux/amd64, darwin/arm64, ...).
+type ReleaseChecksum map[string]string
+
+// UnmarshalYAML accepts a checksum or a map of platform keys to checksums
+func (c *ReleaseChecksum) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = ReleaseChecksum{"all": node.Value}
+		return nil
+	}
+
+	var checksums map[string]string
+	if err := node.Decode(&checksums); err != nil {
+		return err
+	}
+	*c = checksums
+	return nil
+}
+
+// releaseTemplateData is passed to the URL and bin templates
+type releaseTemplateData struct {
+	OS      string
+	Arch    string
+	Version string
+}
+
+// parseReleaseSpec decodes the value of a `release:` key
+func parseReleaseSpec(value interface{}) (*ReleaseSpec, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec ReleaseSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid release: %w", err)
+	}
+	if spec.URL == "" {
+		return nil, fmt.Errorf("invalid release: no url")
+	}
+	return &spec, nil
+}
+
+// Resolve renders the URL and bin templates and picks the checksum for a platform
+func (s *ReleaseSpec) Resolve(platform Platform) (*ResolvedRelease, error) {
+	data := releaseTemplateData{OS: platform.OS, Arch: platform.Arch, Version: s.Version}
+	if name, ok := s.OS[data.OS]; ok {
+		data.OS = name
+	}
+	if name, ok := s.Arch[data.Arch]; ok {
+		data.Arch = name
+	}
+
+	release := &ResolvedRelease{Extract: s.Extract}
+
+	var err error
+	if release.URL, err = renderReleaseTemplate(s.URL, data); err != nil {
+		return nil, err
+	}
+	for _, bin := range s.Bin {
+		rendered, err := renderReleaseTemplate(bin, data)
+		if err != nil {
+			return nil, err
+		}
+		release.Bin = append(release.Bin, rendered)
+	}
+
+	checksums := make(map[string]interface{}, len(s.SHA256))
+	for key, checksum := range s.SHA256 {
+		checksums[key] = checksum
+	}
+	checksum, _, ok := platform.Resolve(checksums)
+	if !ok {
+		return nil, fmt.Errorf("no sha256 for platform: %s", platform)
+	}
+	release.SHA256 = strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", checksum)))
+	if decoded, err := hex.DecodeString(release.SHA256); err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("invalid sha256 for platform %s: %q", platform, release.SHA256)
+	}
+
+	if release.Extract == "" {
+		release.Extract = inferExtract(release.URL)
+	}
+	if len(release.Bin) == 0 {
+		if release.Extract != ExtractNone && release.Extract != ExtractGz {
+			return nil, fmt.Errorf("invalid release: no bin to install from the %s archive", release.Extract)
+		}
+		release.Bin = PackageList{strings.TrimSuffix(releaseFileName(release.URL), ".gz")}
+	}
+
+	return release, nil
+}
+
+// renderReleaseTemplate executes a URL or bin template
+func renderReleaseTemplate(text string, data releaseTemplateData) (string, error) {
+	tmpl, err := template.New("release").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid release template %q: %w", text, err)
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("invalid release template %q: %w", text, err)
+	}
+	return rendered.String(), nil
+}
+
+// releaseFileName returns the file name of a download URL, without query string or fragment
+func releaseFileName(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	return path.Base(url)
+}
+
+// inferExtract returns the archive format of a download from its file name
+func inferExtract(url string) string {
+	name := strings.ToLower(releaseFileName(url))
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ExtractTarGz
+	case strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"):
+		return ExtractTarBz2
+	case strings.HasSuffix(name, ".tar"):
+		return ExtractTar
+	case strings.HasSuffix(name, ".zip"):
+		return ExtractZip
+	case strings.HasSuffix(name, ".gz"):
+		return ExtractGz
+	default:
+		return ExtractNone
+	}
+}
+
+// ResolvedRelease is a ReleaseSpec rendered for a platform
+type ResolvedRelease struct {
+	URL     string      // Download URL
+	SHA256  string      // Expected checksum, lower-case hex
+	Extract string      // Archive format
+	Bin     PackageList // Paths or globs of the binaries in the archive
+}
+
+// String describes the release install, as shown in install plans
+func (r *ResolvedRelease) String() string {
+	names := make([]string, 0, len(r.Bin))
+	for _, bin := range r.Bin {
+		names = append(names, path.Base(bin))
+	}
+	return "download " + r.URL + " (" + strings.Join(names, ", ") + ")"
+}
+
+// ReleaseInstaller downloads release archives and installs their binaries
+type ReleaseInstaller struct {
+	Client *http.Client // Client downloading the archives
+	BinDir string       // Directory receiving the binaries
+}
+
+// DefaultBinDir returns ~/.local/bin, the directory release binaries are installed to
+func DefaultBinDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".local", "bin")
+}
+
+// NewReleaseInstaller creates a ReleaseInstaller installing into ~/.local/bin
+func NewReleaseInstaller() ReleaseInstaller {
+	return ReleaseInstaller{Client: http.DefaultClient, BinDir: DefaultBinDir()}
+}
+
+// Install downloads a release, verifies its checksum and installs its binaries.
+// Progress is written to output. Returns the paths of the installed binaries.
+func (r ReleaseInstaller) Install(ctx context.Context, release *ResolvedRelease, output io.Writer) ([]string, error) {
+	if r.BinDir == "" {
+		return nil, fmt.Errorf("no directory to install binaries to")
+	}
+	if release.SHA256 == "" {
+		return nil, fmt.Errorf("no sha256 for %s", release.URL)
+	}
+
+	fmt.Fprintf(output, "Downloading %s\n", release.URL)
+	archive, err := r.download(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	fmt.Fprintf(output, "Verified sha256 %s\n", release.SHA256)
+
+	if err := os.MkdirAll(r.BinDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", r.BinDir, err)
+	}
+
+	installed, err := r.extract(archive, release)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bin := range installed {
+		fmt.Fprintf(output, "Installed %s\n", bin)
+	}
+	return installed, nil
+}
+
+// download saves the release to a temporary file and verifies its checksum
+func (r ReleaseInstaller) download(ctx context.Context, release *ResolvedRelease) (*os.File, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, release.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", release.URL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", release.URL, response.Status)
+	}
+
+	file, err := os.CreateTemp("", "dotfile-agent-release-")
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), response.Body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to download %s: %w", release.URL, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != release.SHA256 {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", release.URL, release.SHA256, sum)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// extract installs the binaries of the archive matching the bin patterns
+func (r ReleaseInstaller) extract(archive *os.File, release *ResolvedRelease) ([]string, error) {
+	var installed []string
+	matched := make(map[string]bool)
+
+	install := func(name string, content io.Reader) error {
+		for _, pattern := range release.Bin {
+			if !matchBin(pattern, name) {
+				continue
+			}
+
+			target := filepath.Join(r.BinDir, path.Base(name))
+			if err := writeBinary(target, content); err != nil {
+				return err
+			}
+			matched[pattern] = true
+			installed = append(installed, target)
+			return nil
+		}
+		return nil
+	}
+
+	switch release.Extract {
+	case ExtractTarGz, ExtractTarBz2, ExtractTar:
+		var reader io.Reader = archive
+		switch release.Extract {
+		case ExtractTarGz:
+			gz, err := gzip.NewReader(archive)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", release.URL, err)
+			}
+			defer gz.Close()
+			reader = gz
+		case ExtractTarBz2:
+			reader = bzip2.NewReader(archive)
+		}
+
+		tarReader := tar.NewReader(reader)
+		for {
+			header, err := tarReader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", release.URL, err)
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := install(header.Name, tarReader); err != nil {
+				return nil, err
+			}
+		}
+	case ExtractZip:
+		info, err := archive.Stat()
+		if err != nil {
+			return nil, err
+		}
+		zipReader, err := zip.NewReader(archive, info.Size())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", release.URL, err)
+		}
+		for _, file := range zipReader.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			content, err := file.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", release.URL, err)
+			}
+			err = install(file.Name, content)
+			content.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case ExtractGz:
+		gz, err := gzip.NewReader(archive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", release.URL, err)
+		}
+		defer gz.Close()
+		if err := install(release.Bin[0], gz); err != nil {
+			return nil, err
+		}
+	case ExtractNone:
+		if err := install(release.Bin[0], archive); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown archive format %q (available: %s, %s, %s, %s, %s, %s)", release.Extract,
+			ExtractTarGz, ExtractTarBz2, ExtractTar, ExtractZip, ExtractGz, ExtractNone)
+	}
+
+	for _, pattern := range release.Bin {
+		if !matched[pattern] {
+			return nil, fmt.Errorf("%s not found in %s", pattern, release.URL)
+		}
+	}
+	return installed, nil
+}
+
+// matchBin reports whether an archive path matches a bin pattern.
+// Patterns without a slash match the file name in any directory.
+func matchBin(pattern, name string) bool {
+	name = strings.TrimPrefix(path.Clean(name), "./")
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+
+	ok, _ := path.Match(strings.TrimPrefix(pattern, "./"), name)
+	return ok
+}
+
+// writeBinary atomically writes an executable file
+func writeBinary(target string, content io.Reader) error {
+	file, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".")
+	if err != nil {
+		return fmt.Errorf("failed to install %s: %w", target, err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to install %s: %w", target, err)
+	}
+	if err := file.Chmod(0755); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to install %s: %w", target, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to install %s: %w", target, err)
+	}
+
+	if err := os.Rename(file.Name(), target); err != nil {
+		return fmt.Errorf("failed to install %s: %w", target, err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// releaseFile is a file of a test release archive
+type releaseFile struct {
+	name    string
+	content string
+}
+
+func tarGzArchive(t *testing.T, files ...releaseFile) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gz)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func zipArchive(t *testing.T, files ...releaseFile) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	zipWriter := zip.NewWriter(&buffer)
+	for _, file := range files {
+		writer, err := zipWriter.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func gzipFile(t *testing.T, content string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	if _, err := gz.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// releaseServer serves downloads by path and answers 404 for anything else
+func releaseServer(t *testing.T, downloads map[string][]byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		content, ok := downloads[request.URL.Path]
+		if !ok {
+			http.NotFound(writer, request)
+			return
+		}
+		_, _ = writer.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestReleaseInstallerInstall(t *testing.T) {
+	tarGz := tarGzArchive(t,
+		releaseFile{"ripgrep-14.1.0-x86_64/README.md", "readme"},
+		releaseFile{"ripgrep-14.1.0-x86_64/rg", "rg binary"},
+		releaseFile{"ripgrep-14.1.0-x86_64/doc/rg.1", "man page"},
+	)
+	zipped := zipArchive(t,
+		releaseFile{"tool/bin/tool", "tool binary"},
+		releaseFile{"tool/bin/tool-helper", "helper binary"},
+	)
+	gz := gzipFile(t, "gz binary")
+	plain := []byte("plain binary")
+
+	server := releaseServer(t, map[string][]byte{
+		"/rg.tar.gz":   tarGz,
+		"/tool.zip":    zipped,
+		"/single.gz":   gz,
+		"/plain-linux": plain,
+	})
+
+	tests := []struct {
+		name    string
+		release ResolvedRelease
+		want    map[string]string // Installed file name -> content
+		err     string
+		partial bool // Bins found before the error are installed
+	}{
+		{
+			name:    "tar.gz with glob bin",
+			release: ResolvedRelease{URL: server.URL + "/rg.tar.gz", SHA256: sha256Hex(tarGz), Extract: ExtractTarGz, Bin: PackageList{"ripgrep-*/rg"}},
+			want:    map[string]string{"rg": "rg binary"},
+		},
+		{
+			name:    "zip with name glob in any directory",
+			release: ResolvedRelease{URL: server.URL + "/tool.zip", SHA256: sha256Hex(zipped), Extract: ExtractZip, Bin: PackageList{"tool*"}},
+			want:    map[string]string{"tool": "tool binary", "tool-helper": "helper binary"},
+		},
+		{
+			name:    "zip with several bins",
+			release: ResolvedRelease{URL: server.URL + "/tool.zip", SHA256: sha256Hex(zipped), Extract: ExtractZip, Bin: PackageList{"tool/bin/tool", "tool-helper"}},
+			want:    map[string]string{"tool": "tool binary", "tool-helper": "helper binary"},
+		},
+		{
+			name:    "gz",
+			release: ResolvedRelease{URL: server.URL + "/single.gz", SHA256: sha256Hex(gz), Extract: ExtractGz, Bin: PackageList{"single"}},
+			want:    map[string]string{"single": "gz binary"},
+		},
+		{
+			name:    "none",
+			release: ResolvedRelease{URL: server.URL + "/plain-linux", SHA256: sha256Hex(plain), Extract: ExtractNone, Bin: PackageList{"plain"}},
+			want:    map[string]string{"plain": "plain binary"},
+		},
+		{
+			name:    "checksum mismatch",
+			release: ResolvedRelease{URL: server.URL + "/rg.tar.gz", SHA256: sha256Hex(zipped), Extract: ExtractTarGz, Bin: PackageList{"rg"}},
+			err:     "checksum mismatch",
+		},
+		{
+			name:    "not found",
+			release: ResolvedRelease{URL: server.URL + "/missing.tar.gz", SHA256: sha256Hex(tarGz), Extract: ExtractTarGz, Bin: PackageList{"rg"}},
+			err:     "404 Not Found",
+		},
+		{
+			name:    "bin not in archive",
+			release: ResolvedRelease{URL: server.URL + "/rg.tar.gz", SHA256: sha256Hex(tarGz), Extract: ExtractTarGz, Bin: PackageList{"rg", "fd"}},
+			err:     "fd not found in " + server.URL + "/rg.tar.gz",
+			partial: true,
+		},
+		{
+			name:    "glob not matching the directory",
+			release: ResolvedRelease{URL: server.URL + "/rg.tar.gz", SHA256: sha256Hex(tarGz), Extract: ExtractTarGz, Bin: PackageList{"fd-*/rg"}},
+			err:     "fd-*/rg not found",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			binDir := filepath.Join(t.TempDir(), "bin")
+			installer := ReleaseInstaller{Client: server.Client(), BinDir: binDir}
+
+			installed, err := installer.Install(context.Background(), &test.release, io.Discard)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				if entries, _ := os.ReadDir(binDir); len(entries) > 0 && !test.partial {
+					t.Fatalf("%d files installed despite the error", len(entries))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(installed) != len(test.want) {
+				t.Fatalf("installed %v, want %d binaries", installed, len(test.want))
+			}
+			for name, content := range test.want {
+				target := filepath.Join(binDir, name)
+				data, err := os.ReadFile(target)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != content {
+					t.Errorf("%s contains %q, want %q", name, data, content)
+				}
+				if info, _ := os.Stat(target); info.Mode().Perm()&0111 == 0 {
+					t.Errorf("%s is not executable", name)
+				}
+			}
+		})
+	}
+}
+
+func TestReleaseSpecResolve(t *testing.T) {
+	checksum := strings.Repeat("ab", sha256.Size)
+	platform := Platform{OS: "linux", Arch: "amd64"}
+
+	tests := []struct {
+		name    string
+		spec    ReleaseSpec
+		url     string
+		extract string
+		bin     []string
+		err     string
+	}{
+		{
+			name:    "templates",
+			spec:    ReleaseSpec{URL: "https://example.com/{{.Version}}/rg-{{.Arch}}-{{.OS}}.tar.gz", Version: "1.0", Arch: map[string]string{"amd64": "x86_64"}, Bin: PackageList{"rg-{{.Version}}/rg"}},
+			url:     "https://example.com/1.0/rg-x86_64-linux.tar.gz",
+			extract: ExtractTarGz,
+			bin:     []string{"rg-1.0/rg"},
+		},
+		{
+			name:    "default bin without query string",
+			spec:    ReleaseSpec{URL: "https://example.com/download/foo?x=y"},
+			url:     "https://example.com/download/foo?x=y",
+			extract: ExtractNone,
+			bin:     []string{"foo"},
+		},
+		{
+			name:    "default gz bin without query string",
+			spec:    ReleaseSpec{URL: "https://example.com/download/foo-linux.gz?token=abc#top"},
+			url:     "https://example.com/download/foo-linux.gz?token=abc#top",
+			extract: ExtractGz,
+			bin:     []string{"foo-linux"},
+		},
+		{
+			name: "archive without bin",
+			spec: ReleaseSpec{URL: "https://example.com/foo.zip?x=y"},
+			err:  "no bin to install from the zip archive",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.spec.SHA256 = ReleaseChecksum{"all": checksum}
+			release, err := test.spec.Resolve(platform)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if release.URL != test.url || release.Extract != test.extract || strings.Join(release.Bin, ",") != strings.Join(test.bin, ",") {
+				t.Errorf("got %s %s %v, want %s %s %v", release.URL, release.Extract, release.Bin, test.url, test.extract, test.bin)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Git hosting providers selectable with --provider
+const (
+	// AutoProvider detects the provider from the host of the git URL
+	AutoProvider = "auto"
+
+	// GithubProvider uses the GitHub REST API (github.com and GitHub Enterprise)
+	GithubProvider = "github"
+
+	// GitlabProvider uses the GitLab REST API v4 (gitlab.com and self-hosted)
+	GitlabProvider = "gitlab"
+
+	// GiteaProvider uses the Gitea API v1, also served by Forgejo and Codeberg
+	GiteaProvider = "gitea"
+
+	// BitbucketProvider uses the Bitbucket Cloud API 2.0
+	BitbucketProvider = "bitbucket"
+
+	// GitProvider lists the remote refs like `git ls-remote`, without API or token
+	GitProvider = "git"
+)
+
+// Providers returns the names accepted by --provider
+func Providers() []string {
+	return []string{AutoProvider, GithubProvider, GitlabProvider, GiteaProvider, BitbucketProvider, GitProvider}
+}
+
+// providerTokenEnv lists the environment variables holding the API token of each provider,
+// in lookup order. A token is only sent to the provider it belongs to: the git provider
+// has none of its own, and hosts of unknown providers get no token.
+var providerTokenEnv = map[string][]string{
+	GithubProvider:    {"GITHUB_TOKEN", "GH_TOKEN"},
+	GitlabProvider:    {"GITLAB_TOKEN"},
+	GiteaProvider:     {"GITEA_TOKEN"},
+	BitbucketProvider: {"BITBUCKET_TOKEN"},
+}
+
+// RemoteProvider looks up commits of the remote repository with the API of its hosting provider
+type RemoteProvider interface {
+	// Commit returns the commit a branch or tag points to, named in full (refs/heads/main,
+	// refs/tags/v1.0) or short, or the commit of a SHA
+	Commit(ref string) (*Commit, error)
+}
+
+// ValidateProvider returns an error if the provider is not supported
+func ValidateProvider(provider string) error {
+	if !slices.Contains(Providers(), provider) {
+		return fmt.Errorf("unknown provider %q, supported: %s", provider, strings.Join(Providers(), ", "))
+	}
+	return nil
+}
+
+// DetectProvider returns the provider of a git host: github.com, gitlab, bitbucket and gitea
+// hosts are recognised by name (codeberg.org runs Forgejo). Other hosts, such as GitHub
+// Enterprise servers, use git unless --provider is given, as are local and file://
+// repositories, which have no host.
+func DetectProvider(host string) string {
+	host = strings.ToLower(host)
+	switch {
+	case host == "github.com":
+		return GithubProvider
+	case host == "bitbucket.org":
+		return BitbucketProvider
+	case strings.Contains(host, "gitlab"):
+		return GitlabProvider
+	case host == "codeberg.org" || strings.Contains(host, "gitea") || strings.Contains(host, "forgejo"):
+		return GiteaProvider
+	default:
+		return GitProvider
+	}
+}
+
+// DefaultApiBaseUrl returns the API base URL of a provider serving a git host
+func DefaultApiBaseUrl(provider string, host string) string {
+	switch provider {
+	case GitlabProvider:
+		return "https://" + host + "/api/v4"
+	case GiteaProvider:
+		return "https://" + host + "/api/v1"
+	case BitbucketProvider:
+		return "https://api.bitbucket.org/2.0"
+	default:
+		if strings.EqualFold(host, "github.com") {
+			return "https://api.github.com"
+		}
+		return "https://" + host + "/api/v3" // GitHub Enterprise Server
+	}
+}
+
+// NewRemoteProvider creates the RemoteProvider selected in the configuration
+func NewRemoteProvider(config *Configurations) RemoteProvider {
+	api := providerApi{
+		client:     http.DefaultClient,
+		baseUrl:    strings.TrimSuffix(config.GitApiBaseUrl, "/"),
+		owner:      config.RepositoryOwner,
+		repository: config.GitRepository,
+		token:      config.Token,
+	}
+
+	switch config.Provider {
+	case GitProvider:
+		return gitProvider{Git{config}}
+	case GitlabProvider:
+		return gitlabProvider{api}
+	case GiteaProvider:
+		return giteaProvider{api}
+	case BitbucketProvider:
+		return bitbucketProvider{api}
+	default:
+		return githubProvider{api}
+	}
+}
+
+// providerApi holds the API endpoint and repository shared by the providers
+type providerApi struct {
+	client     *http.Client
+	baseUrl    string // API base URL without trailing slash
+	owner      string // Owner, organisation, workspace or group path (group/subgroup)
+	repository string // Repository name
+	token      string // API token, empty for anonymous requests
+}
+
+// get performs a GET request and decodes the JSON response into v.
+// Client errors other than timeouts and rate limiting are permanent and not retried.
+func (a providerApi) get(path string, header http.Header, v any) error {
+	request, err := http.NewRequest(http.MethodGet, a.baseUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	request.Header = header
+	request.Header.Set("Accept", "application/json")
+
+	response, err := a.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	statusCode := response.StatusCode
+
+	if statusCode != http.StatusOK {
+		err := fmt.Errorf("unable to fetch remote commit: %v", statusCode)
+		if isPermanentStatus(statusCode) {
+			return Permanent(err)
+		}
+		return err
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response body: %v", err)
+	}
+	return nil
+}
+
+// header returns request headers with the token in the given scheme, or none without token
+func (a providerApi) header(name string, scheme string) http.Header {
+	header := http.Header{}
+	if a.token != "" {
+		header.Set(name, scheme+a.token)
+	}
+	return header
+}
+
+// githubProvider looks up commits with GET /repos/{owner}/{repo}/commits/{ref}
+type githubProvider struct {
+	providerApi
+}
+
+func (p githubProvider) Commit(ref string) (*Commit, error) {
+	var response GitHttpCommitResponse
+	path := "/repos/" + url.PathEscape(p.owner) + "/" + url.PathEscape(p.repository) + "/commits/" + escapeRefPath(ref)
+	if err := p.get(path, p.header("Authorization", "Bearer "), &response); err != nil {
+		return nil, err
+	}
+
+	return &Commit{
+		Id:         response.Sha,
+		Time:       response.Commit.Author.Date,
+		AuthorName: response.Commit.Author.Name,
+		Message:    response.Commit.Message,
+	}, nil
+}
+
+// gitlabProvider looks up commits with GET /projects/{group%2Frepo}/repository/commits/{ref}.
+// The project is addressed by its full path, so nested groups work.
+type gitlabProvider struct {
+	providerApi
+}
+
+func (p gitlabProvider) Commit(ref string) (*Commit, error) {
+	var response struct {
+		Id           string `json:"id"`
+		AuthorName   string `json:"author_name"`
+		AuthoredDate string `json:"authored_date"`
+		Message      string `json:"message"`
+	}
+	path := "/projects/" + url.PathEscape(p.owner+"/"+p.repository) + "/repository/commits/" + url.PathEscape(ref)
+	if err := p.get(path, p.header("PRIVATE-TOKEN", ""), &response); err != nil {
+		return nil, err
+	}
+
+	return &Commit{
+		Id:         response.Id,
+		Time:       response.AuthoredDate,
+		AuthorName: response.AuthorName,
+		Message:    response.Message,
+	}, nil
+}
+
+// giteaProvider looks up commits with GET /repos/{owner}/{repo}/commits?sha={ref}&limit=1,
+// which accepts branches, tags and SHAs and answers in the GitHub commit format
+type giteaProvider struct {
+	providerApi
+}
+
+func (p giteaProvider) Commit(ref string) (*Commit, error) {
+	var response []GitHttpCommitResponse
+	path := "/repos/" + url.PathEscape(p.owner) + "/" + url.PathEscape(p.repository) +
+		"/commits?limit=1&stat=false&verification=false&files=false&sha=" + url.QueryEscape(ref)
+	if err := p.get(path, p.header("Authorization", "token "), &response); err != nil {
+		return nil, err
+	}
+
+	if len(response) == 0 {
+		return nil, Permanent(errors.New("remote repository has no commits"))
+	}
+
+	return &Commit{
+		Id:         response[0].Sha,
+		Time:       response[0].Commit.Author.Date,
+		AuthorName: response[0].Commit.Author.Name,
+		Message:    response[0].Commit.Message,
+	}, nil
+}
+
+// bitbucketProvider looks up commits with GET /repositories/{workspace}/{repo}/commits/{ref}?pagelen=1.
+// Tokens are access tokens sent as Bearer, or `username:app-password` sent as basic auth.
+type bitbucketProvider struct {
+	providerApi
+}
+
+func (p bitbucketProvider) Commit(ref string) (*Commit, error) {
+	var response struct {
+		Values []struct {
+			Hash    string `json:"hash"`
+			Date    string `json:"date"`
+			Message string `json:"message"`
+			Author  struct {
+				Raw  string `json:"raw"` // Name <email>
+				User struct {
+					DisplayName string `json:"display_name"`
+				} `json:"user"`
+			} `json:"author"`
+		} `json:"values"`
+	}
+
+	header := p.header("Authorization", "Bearer ")
+	if username, password, ok := strings.Cut(p.token, ":"); ok {
+		request := http.Request{Header: http.Header{}}
+		request.SetBasicAuth(username, password)
+		header = request.Header
+	}
+
+	path := "/repositories/" + url.PathEscape(p.owner) + "/" + url.PathEscape(p.repository) + "/commits/" + url.PathEscape(ref) + "?pagelen=1"
+	if err := p.get(path, header, &response); err != nil {
+		return nil, err
+	}
+
+	if len(response.Values) == 0 {
+		return nil, Permanent(errors.New("remote repository has no commits"))
+	}
+
+	commit := response.Values[0]
+	author := commit.Author.User.DisplayName
+	if author == "" {
+		author, _, _ = strings.Cut(commit.Author.Raw, " <")
+	}
+
+	return &Commit{
+		Id:         commit.Hash,
+		Time:       commit.Date,
+		AuthorName: author,
+		Message:    commit.Message,
+	}, nil
+}
+
+// gitProvider finds commits by listing the refs of the remote like `git ls-remote`, with the
+// credentials used for clones. It needs no API token and works with any remote, including
+// file:// URLs and local bare repositories, but only knows the commit SHA.
+type gitProvider struct {
+	git Git
+}
+
+func (p gitProvider) Commit(ref string) (*Commit, error) {
+	if GitRef(ref).IsCommit() {
+		return &Commit{Id: ref}, nil
+	}
+
+	refs, err := p.git.listRemote()
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := GitRef(ref).resolve(refs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Commit{Id: peeledHash(refs, name).String()}, nil
+}
+
+// escapeRefPath escapes a ref for use in an API path, keeping the slashes of branch names like feature/x
+func escapeRefPath(ref string) string {
+	segments := strings.Split(ref, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	githubCommitBody    = `{"sha":"abc123","commit":{"author":{"name":"Jane","date":"2024-05-01T10:00:00Z"},"message":"Update zshrc"}}`
+	gitlabCommitBody    = `{"id":"abc123","author_name":"Jane","authored_date":"2024-05-01T10:00:00Z","message":"Update zshrc"}`
+	giteaCommitBody     = `[` + githubCommitBody + `]`
+	bitbucketCommitBody = `{"values":[{"hash":"abc123","date":"2024-05-01T10:00:00Z","message":"Update zshrc","author":{"raw":"Jane <jane@example.com>","user":{}}}]}`
+)
+
+func TestRemoteProviderCommit(t *testing.T) {
+	commit := &Commit{Id: "abc123", Time: "2024-05-01T10:00:00Z", AuthorName: "Jane", Message: "Update zshrc"}
+	basicAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("jane:app-password"))
+
+	tests := []struct {
+		name      string
+		provider  string
+		owner     string
+		token     string
+		ref       string
+		status    int
+		body      string
+		uri       string // Request path and query the provider must use
+		auth      string // Header name and value, e.g. "Authorization: Bearer t"
+		want      *Commit
+		err       string
+		permanent bool
+	}{
+		{
+			name: "github", provider: GithubProvider, owner: "jane", token: "ghp", ref: "feature/x",
+			status: http.StatusOK, body: githubCommitBody,
+			uri: "/repos/jane/dotfiles/commits/feature/x", auth: "Authorization: Bearer ghp", want: commit,
+		},
+		{
+			name: "github without token", provider: GithubProvider, owner: "jane", ref: "main",
+			status: http.StatusOK, body: githubCommitBody,
+			uri: "/repos/jane/dotfiles/commits/main", want: commit,
+		},
+		{
+			name: "github not found", provider: GithubProvider, owner: "jane", token: "ghp", ref: "main",
+			status: http.StatusNotFound, body: `{"message":"Not Found"}`,
+			uri: "/repos/jane/dotfiles/commits/main", auth: "Authorization: Bearer ghp", err: "404", permanent: true,
+		},
+		{
+			name: "github rate limited", provider: GithubProvider, owner: "jane", token: "ghp", ref: "main",
+			status: http.StatusTooManyRequests,
+			uri:    "/repos/jane/dotfiles/commits/main", auth: "Authorization: Bearer ghp", err: "429",
+		},
+		{
+			name: "github invalid json", provider: GithubProvider, owner: "jane", ref: "main",
+			status: http.StatusOK, body: `<html>`,
+			uri: "/repos/jane/dotfiles/commits/main", err: "failed to decode response body",
+		},
+		{
+			name: "gitlab nested group", provider: GitlabProvider, owner: "group/subgroup", token: "glpat", ref: "v1.0",
+			status: http.StatusOK, body: gitlabCommitBody,
+			uri: "/projects/group%2Fsubgroup%2Fdotfiles/repository/commits/v1.0", auth: "Private-Token: glpat", want: commit,
+		},
+		{
+			name: "gitlab unauthorized", provider: GitlabProvider, owner: "group/subgroup", token: "glpat", ref: "main",
+			status: http.StatusUnauthorized, body: `{"message":"401 Unauthorized"}`,
+			uri: "/projects/group%2Fsubgroup%2Fdotfiles/repository/commits/main", auth: "Private-Token: glpat", err: "401", permanent: true,
+		},
+		{
+			name: "gitea", provider: GiteaProvider, owner: "jane", token: "tea", ref: "main",
+			status: http.StatusOK, body: giteaCommitBody,
+			uri:  "/repos/jane/dotfiles/commits?limit=1&stat=false&verification=false&files=false&sha=main",
+			auth: "Authorization: token tea", want: commit,
+		},
+		{
+			name: "gitea empty list", provider: GiteaProvider, owner: "jane", token: "tea", ref: "main",
+			status: http.StatusOK, body: `[]`,
+			uri:  "/repos/jane/dotfiles/commits?limit=1&stat=false&verification=false&files=false&sha=main",
+			auth: "Authorization: token tea", err: "remote repository has no commits", permanent: true,
+		},
+		{
+			name: "gitea server error", provider: GiteaProvider, owner: "jane", ref: "main",
+			status: http.StatusBadGateway,
+			uri:    "/repos/jane/dotfiles/commits?limit=1&stat=false&verification=false&files=false&sha=main", err: "502",
+		},
+		{
+			name: "bitbucket access token", provider: BitbucketProvider, owner: "workspace", token: "atbb", ref: "main",
+			status: http.StatusOK, body: bitbucketCommitBody,
+			uri: "/repositories/workspace/dotfiles/commits/main?pagelen=1", auth: "Authorization: Bearer atbb", want: commit,
+		},
+		{
+			name: "bitbucket app password", provider: BitbucketProvider, owner: "workspace", token: "jane:app-password", ref: "main",
+			status: http.StatusOK, body: bitbucketCommitBody,
+			uri: "/repositories/workspace/dotfiles/commits/main?pagelen=1", auth: "Authorization: " + basicAuth, want: commit,
+		},
+		{
+			name: "bitbucket forbidden", provider: BitbucketProvider, owner: "workspace", token: "jane:app-password", ref: "main",
+			status: http.StatusForbidden,
+			uri:    "/repositories/workspace/dotfiles/commits/main?pagelen=1", auth: "Authorization: " + basicAuth, err: "403", permanent: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.RequestURI != test.uri {
+					t.Errorf("requested %s, want %s", request.RequestURI, test.uri)
+				}
+				authName, authValue, _ := strings.Cut(test.auth, ": ")
+				for _, name := range []string{"Authorization", "Private-Token"} {
+					want := ""
+					if name == authName {
+						want = authValue
+					}
+					if got := request.Header.Get(name); got != want {
+						t.Errorf("got %s header %q, want %q", name, got, want)
+					}
+				}
+				writer.WriteHeader(test.status)
+				_, _ = writer.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			provider := NewRemoteProvider(&Configurations{
+				Provider:        test.provider,
+				GitApiBaseUrl:   server.URL + "/",
+				RepositoryOwner: test.owner,
+				GitRepository:   "dotfiles",
+				Token:           test.token,
+			})
+
+			got, err := provider.Commit(test.ref)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				if permanent := errors.As(err, &permanentError{}); permanent != test.permanent {
+					t.Errorf("permanent is %v, want %v", permanent, test.permanent)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDetectProvider(t *testing.T) {
+	tests := map[string]string{
+		"github.com":          GithubProvider,
+		"GitHub.com":          GithubProvider,
+		"gitlab.com":          GitlabProvider,
+		"gitlab.example.com":  GitlabProvider,
+		"bitbucket.org":       BitbucketProvider,
+		"codeberg.org":        GiteaProvider,
+		"forgejo.example.com": GiteaProvider,
+		"git.example.com":     GitProvider,
+		"github.example.com":  GitProvider,
+		"":                    GitProvider,
+	}
+
+	for host, want := range tests {
+		if got := DetectProvider(host); got != want {
+			t.Errorf("DetectProvider(%q) = %s, want %s", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describes how network operations are retried on transient failures.
+// Delays grow exponentially from BaseDelay and are capped at MaxDelay;
+// Jitter randomizes each delay by up to that fraction in either direction.
+type RetryPolicy struct {
+	Attempts  int           // Total number of attempts, including the first one
+	BaseDelay time.Duration // Delay before the second attempt
+	MaxDelay  time.Duration // Upper bound for any delay (0 leaves delays uncapped)
+	Jitter    float64       // Fraction of the delay to randomize (0 disables jitter)
+}
+
+// DefaultRetryPolicy is used when no retry flags are given
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  5,
+	BaseDelay: time.Second,
+	MaxDelay:  30 * time.Second,
+	Jitter:    0.2,
+}
+
+// RetryNotifier is called before every retry with the upcoming attempt number,
+// the total number of attempts, the error of the failed attempt and the delay before retrying.
+type RetryNotifier func(attempt int, attempts int, err error, delay time.Duration)
+
+// permanentError marks an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// Permanent wraps an error so that RetryPolicy.Do stops retrying immediately
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Validate returns an error if the policy cannot be used
+func (p RetryPolicy) Validate() error {
+	if p.Attempts < 1 {
+		return errors.New("retry attempts must be at least 1")
+	}
+
+	if p.BaseDelay < 0 || p.MaxDelay < 0 {
+		return errors.New("retry delays must not be negative")
+	}
+
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1, got %v", p.Jitter)
+	}
+
+	return nil
+}
+
+// Delay returns the delay to wait before the given attempt (2 for the first retry)
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 2; i < attempt && (p.MaxDelay == 0 || delay < p.MaxDelay) && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + p.Jitter*(2*rand.Float64()-1)))
+	}
+
+	return delay
+}
+
+// Do runs op until it succeeds, returns a permanent error or the attempts are exhausted.
+// notifier, when not nil, is told about every retry before waiting.
+func (p RetryPolicy) Do(op func() error, notifier RetryNotifier) error {
+	return p.DoContext(context.Background(), op, notifier)
+}
+
+// DoContext is Do stopping as soon as ctx is done, without waiting for the next attempt.
+// The returned error then wraps the context error and mentions the last failure.
+func (p RetryPolicy) DoContext(ctx context.Context, op func() error, notifier RetryNotifier) error {
+	attempts := max(p.Attempts, 1)
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			delay := p.Delay(attempt)
+			if notifier != nil {
+				notifier(attempt, attempts, err, delay)
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+			case <-timer.C:
+			}
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err = op()
+		if err == nil {
+			return nil
+		}
+
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+	}
+
+	if attempts > 1 {
+		return fmt.Errorf("%w (gave up after %d attempts)", err, attempts)
+	}
+
+	return err
+}
+
+// logRetry returns a RetryNotifier that logs retries of an operation
+func logRetry(operation string) RetryNotifier {
+	return func(attempt int, attempts int, err error, delay time.Duration) {
+		Infoln(fmt.Sprintf("%s failed: %s - retrying (%d/%d) in %s", operation, err.Error(), attempt, attempts, delay.Round(time.Millisecond)))
+	}
+}
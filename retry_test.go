@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	capped := RetryPolicy{Attempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	uncapped := RetryPolicy{Attempts: 10, BaseDelay: time.Second}
+
+	tests := []struct {
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{capped, 2, time.Second},
+		{capped, 3, 2 * time.Second},
+		{capped, 4, 4 * time.Second},
+		{capped, 5, 8 * time.Second},
+		{capped, 6, 10 * time.Second},
+		{capped, 7, 10 * time.Second},
+		{capped, 1000, 10 * time.Second},
+		{uncapped, 6, 16 * time.Second},
+		{RetryPolicy{BaseDelay: 20 * time.Second, MaxDelay: 10 * time.Second}, 2, 10 * time.Second},
+	}
+
+	for _, test := range tests {
+		if got := test.policy.Delay(test.attempt); got != test.want {
+			t.Errorf("Delay(%d) with %+v = %s, want %s", test.attempt, test.policy, got, test.want)
+		}
+	}
+
+	// Uncapped delays stop growing instead of overflowing
+	if delay := uncapped.Delay(1000); delay < uncapped.Delay(60) {
+		t.Errorf("Delay(1000) without a cap = %s", delay)
+	}
+}
+
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 10 * time.Second, Jitter: 0.2}
+
+	for i := 0; i < 100; i++ {
+		if delay := policy.Delay(5); delay < 6400*time.Millisecond || delay > 9600*time.Millisecond {
+			t.Fatalf("delay %s is not within 20%% of 8s", delay)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	errTransient := errors.New("connection reset")
+	errDenied := errors.New("access denied")
+
+	tests := []struct {
+		name     string
+		attempts int
+		failures []error // Errors returned by the successive calls, nil once they succeed
+		calls    int
+		retries  []int // Attempt numbers reported to the notifier
+		err      string
+		is       error
+	}{
+		{
+			name:     "success",
+			attempts: 3,
+			calls:    1,
+		},
+		{
+			name:     "success after retries",
+			attempts: 3,
+			failures: []error{errTransient, errTransient},
+			calls:    3,
+			retries:  []int{2, 3},
+		},
+		{
+			name:     "attempts exhausted",
+			attempts: 3,
+			failures: []error{errTransient, errTransient, errTransient},
+			calls:    3,
+			retries:  []int{2, 3},
+			err:      "connection reset (gave up after 3 attempts)",
+			is:       errTransient,
+		},
+		{
+			name:     "single attempt",
+			attempts: 1,
+			failures: []error{errTransient},
+			calls:    1,
+			err:      "connection reset",
+			is:       errTransient,
+		},
+		{
+			name:     "permanent error stops retrying",
+			attempts: 5,
+			failures: []error{errTransient, Permanent(errDenied)},
+			calls:    2,
+			retries:  []int{2},
+			err:      "access denied",
+			is:       errDenied,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := RetryPolicy{Attempts: test.attempts, BaseDelay: time.Microsecond, MaxDelay: time.Millisecond}
+
+			calls := 0
+			var retries []int
+			err := policy.Do(func() error {
+				calls++
+				if calls <= len(test.failures) {
+					return test.failures[calls-1]
+				}
+				return nil
+			}, func(attempt int, attempts int, err error, delay time.Duration) {
+				if attempts != test.attempts || err == nil {
+					t.Errorf("notified of attempt %d/%d after %v", attempt, attempts, err)
+				}
+				retries = append(retries, attempt)
+			})
+
+			if calls != test.calls {
+				t.Errorf("op called %d times, want %d", calls, test.calls)
+			}
+			if fmt.Sprint(retries) != fmt.Sprint(test.retries) {
+				t.Errorf("retries notified %v, want %v", retries, test.retries)
+			}
+
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+			if !errors.Is(err, test.is) {
+				t.Errorf("error %v does not wrap %v", err, test.is)
+			}
+			if errors.As(err, &permanentError{}) {
+				t.Errorf("error %v is still marked permanent", err)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDoContext(t *testing.T) {
+	errTransient := errors.New("connection reset")
+	policy := RetryPolicy{Attempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	t.Run("cancelled while waiting", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		calls := 0
+		done := make(chan error)
+		go func() {
+			done <- policy.DoContext(ctx, func() error {
+				calls++
+				return errTransient
+			}, func(int, int, error, time.Duration) {
+				cancel()
+			})
+		}()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "connection reset") {
+				t.Errorf("got error %v, want the cancellation and the last error", err)
+			}
+			if calls != 1 {
+				t.Errorf("op called %d times, want 1", calls)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("DoContext kept waiting after the context was cancelled")
+		}
+	})
+
+	t.Run("cancelled before the first attempt", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := policy.DoContext(ctx, func() error {
+			t.Error("op called with a cancelled context")
+			return nil
+		}, nil)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	tests := []struct {
+		policy RetryPolicy
+		err    string
+	}{
+		{policy: DefaultRetryPolicy},
+		{policy: RetryPolicy{Attempts: 1}},
+		{policy: RetryPolicy{Attempts: 0}, err: "at least 1"},
+		{policy: RetryPolicy{Attempts: 3, BaseDelay: -time.Second}, err: "must not be negative"},
+		{policy: RetryPolicy{Attempts: 3, Jitter: 1.5}, err: "between 0 and 1"},
+	}
+
+	for _, test := range tests {
+		err := test.policy.Validate()
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("Validate(%+v) = %v, want %q", test.policy, err, test.err)
+		}
+	}
+}
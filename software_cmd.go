@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// softwareCommand builds the `software` command group managing the software of an enhanced config.
+// Install logs are written under the agent config directory.
+func softwareCommand(configDir *string) *cobra.Command {
+	softwareCmd := &cobra.Command{
+		Use:   "software",
+		Short: "Install and inspect the software defined in " + DotfileConfigName,
+	}
+	configPath := softwareCmd.PersistentFlags().StringP("file", "f", DotfileConfigName, "path to the enhanced config")
+
+	installCmd := &cobra.Command{
+		Use:   "install [software...]",
+		Short: "Install all software, or only the given software and their dependencies",
+	}
+	installYes := installCmd.Flags().BoolP("yes", "y", false, "install without asking for confirmation")
+	installJson := installCmd.Flags().Bool("json", false, "print the install report as JSON instead of progress")
+	installTimeout := installCmd.Flags().Duration("timeout", DefaultExecutor.Timeout, "timeout of install commands without their own timeout")
+	installCmd.Run = func(cmd *cobra.Command, args []string) {
+		executor := DefaultExecutor
+		executor.Timeout = *installTimeout
+		if dir := agentConfigDir(*configDir); dir != "" {
+			executor.LogDir = filepath.Join(dir, installLogDir)
+		}
+
+		var err error
+		switch {
+		case *installJson:
+			err = installSoftwareJson(*configPath, args, executor)
+		case len(args) > 0:
+			err = InstallSpecificSoftware(*configPath, args, executor)
+		default:
+			err = InstallSoftware(*configPath, !*installYes, executor)
+		}
+
+		if err != nil {
+			Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	softwareCmd.AddCommand(installCmd)
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <software>",
+		Short: "Uninstall software and delete its deployed files",
+		Args:  cobra.ExactArgs(1),
+	}
+	removeYes := removeCmd.Flags().BoolP("yes", "y", false, "remove without asking for confirmation")
+	removeCmd.Run = func(cmd *cobra.Command, args []string) {
+		executor, stateDir := DefaultExecutor, agentConfigDir(*configDir)
+		if stateDir != "" {
+			executor.LogDir = filepath.Join(stateDir, installLogDir)
+		}
+
+		if err := RemoveSoftware(*configPath, args[0], !*removeYes, executor, stateDir); err != nil {
+			Error(err.Error())
+			os.Exit(1)
+		}
+	}
+	softwareCmd.AddCommand(removeCmd)
+	softwareCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the software defined in the config",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := ListSoftware(*configPath); err != nil {
+				Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	})
+	softwareCmd.AddCommand(&cobra.Command{
+		Use:   "check",
+		Short: "Report software whose installed version does not satisfy its constraint",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := CheckSoftwareVersions(*configPath); err != nil {
+				Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	})
+	softwareCmd.AddCommand(&cobra.Command{
+		Use:   "platforms",
+		Short: "Show the install commands of every platform",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := ShowPlatformInfo(*configPath); err != nil {
+				Error(err.Error())
+				os.Exit(1)
+			}
+		},
+	})
+
+	return softwareCmd
+}
+
+// agentConfigDir returns the agent config directory: the given one, or dotfile-agent
+// in the user config directory. Returns an empty string if it cannot be determined.
+func agentConfigDir(configDir string) string {
+	if configDir != "" {
+		return configDir
+	}
+
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(userConfigDir, "dotfile-agent")
+}
+
+// installSoftwareJson installs software without prompting and prints the InstallReport as JSON
+func installSoftwareJson(configPath string, software []string, executor Executor) error {
+	config, err := ParseEnhancedConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	installer := NewInstaller(config)
+	installer.Executor = executor
+	report, err := installer.Install(software...)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+
+	return report.Err()
+}
@@ -7,14 +7,15 @@ import (
 )
 
 // SseClient implements io.Writer to parse Server-Sent Events from Git webhooks.
-// It triggers automatic synchronization when commits are pushed to the main branch.
+// It triggers automatic synchronization when commits are pushed to the tracked ref.
 type SseClient struct {
 	Syncer Syncer // The syncer to trigger when webhook events are received
+	Ref    GitRef // The tracked ref, pushes to other refs are ignored
 }
 
 // Write implements io.Writer interface to process SSE data from webhook responses.
 // It parses the SSE data field, extracts commit information, and triggers sync
-// if the commit is on the main branch.
+// if the commit is on the tracked ref.
 func (w *SseClient) Write(p []byte) (n int, err error) {
 
 	// Extract data after "data:" prefix in SSE format
@@ -27,13 +28,9 @@ func (w *SseClient) Write(p []byte) (n int, err error) {
 			return 0, err
 		}
 
-		commitRef := commit.Ref
-		if commitRef != "" {
-			// Extract branch name from ref (e.g., "refs/heads/main" -> "main")
-			branch := strings.Split(commitRef, "/")[2]
-			if branch == "main" { // only triggers sync on push to main branch
-				w.Syncer.Sync(ConsoleSyncConsumer)
-			}
+		// Only pushes to the tracked branch or tag (e.g. "refs/heads/main") trigger a sync
+		if commit.Ref != "" && w.Ref.Matches(commit.Ref) {
+			w.Syncer.Sync(ConsoleSyncConsumer)
 		}
 	}
 
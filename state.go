@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// agentStateFile is the name of the agent state file in the configuration directory
+const agentStateFile = "agent-state.json"
+
+// maxHistory is the number of history entries kept in the agent state
+const maxHistory = 100
+
+// AgentState holds what the agent remembers between syncs
+type AgentState struct {
+	KnownSoftware []string       `json:"known_software"`    // Software handled by the last syncs, used to find new entries; nil before the first sync
+	History       []HistoryEntry `json:"history,omitempty"` // Latest changes made to the machine, oldest first
+
+	// What the last syncs deployed per software, so that software dropped from the config can still be removed
+	Deployed map[string]DeployRecord `json:"deployed,omitempty"`
+}
+
+// DeployRecord is what a sync deployed for a software entry
+type DeployRecord struct {
+	Uninstall string            `json:"uninstall,omitempty"` // Uninstall command for this machine at the time of the deploy
+	Files     map[string]string `json:"files"`               // Deployed file or directory -> digest of its content, see contentDigest
+}
+
+// HistoryEntry records a change made to the machine outside of a regular sync, such as a software removal
+type HistoryEntry struct {
+	Time     string   `json:"time"`              // Time of the change in RFC3339 format
+	Action   string   `json:"action"`            // What was done, e.g. "remove"
+	Software string   `json:"software"`          // Software the change is about
+	Success  bool     `json:"success"`           // Whether the change succeeded
+	Files    []string `json:"files,omitempty"`   // Files that were removed
+	Skipped  []string `json:"skipped,omitempty"` // Files that were kept, with the reason
+	Message  string   `json:"message,omitempty"` // Error or detail
+}
+
+// Record appends an entry to the history, dropping the oldest entries beyond maxHistory
+func (s *AgentState) Record(entry HistoryEntry) {
+	if entry.Time == "" {
+		entry.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	s.History = append(s.History, entry)
+	if len(s.History) > maxHistory {
+		s.History = s.History[len(s.History)-maxHistory:]
+	}
+}
+
+// LoadAgentState reads the agent state from the configuration directory.
+// A missing state file yields an empty state.
+func LoadAgentState(configPath string) (*AgentState, error) {
+	state := &AgentState{}
+
+	data, err := os.ReadFile(filepath.Join(configPath, agentStateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, fmt.Errorf("failed to read agent state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse agent state: %w", err)
+	}
+
+	return state, nil
+}
+
+// Save writes the agent state to the configuration directory, replacing it atomically
+func (s *AgentState) Save(configPath string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	statePath := filepath.Join(configPath, agentStateFile)
+	if err := os.WriteFile(statePath+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write agent state: %w", err)
+	}
+
+	return os.Rename(statePath+".tmp", statePath)
+}
+
+// contentDigest returns a SHA-256 digest of a file, link or directory tree: the relative
+// path, type and content of every file in it. Links are not followed.
+func contentDigest(root string) (string, error) {
+	hash := sha256.New()
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s link %q\n", rel, link)
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s file %d\n", rel, info.Size())
+
+			file, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if _, err := io.Copy(hash, file); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintf(hash, "%s %v\n", rel, entry.Type())
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
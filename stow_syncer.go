@@ -1,161 +1,683 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 )
 
+// stowSyncer implements the Syncer interface using a GNU stow compatible repository layout.
+// Every top-level directory in the repository is a package whose contents are symlinked
+// into the home directory, folding and unfolding directory trees the same way stow does.
 type stowSyncer struct {
-	config         *Configurations
-	db             Persistence
-	brokerNotifier *BrokerNotifier
-	mutex          *sync.Mutex
-}
-
-//func NewStowSyncer(config *Configurations, db Persistence, brokerNotifier *BrokerNotifier) Syncer {
-//	return &stowSyncer{
-//		config:         config,
-//		db:             db,
-//		brokerNotifier: brokerNotifier,
-//		mutex:          &sync.Mutex{},
-//	}
-//}
-//
-//func (s *stowSyncer) Sync(ch chan SyncEvent) {
-//
-//	s.mutex.Lock()
-//
-//	steps := []struct {
-//		Step   string
-//		Action func() error
-//	}{
-//		{
-//			Step: "Execute Git pull command",
-//			Action: func() error {
-//				err := os.Chdir(s.config.DotfilePath)
-//				if err != nil {
-//					return err
-//				}
-//				path, err := exec.LookPath("git")
-//				if err != nil {
-//					return err
-//				}
-//
-//				return exec.Command(path, "pull", "origin", "main", "--rebase").Run()
-//			},
-//		},
-//		{
-//			Step: "Execute Stow command",
-//			Action: func() error {
-//				homeDir, err := os.UserHomeDir()
-//				if err != nil {
-//					return err
-//				}
-//
-//				path, err := exec.LookPath("stow")
-//				if err != nil {
-//					return err
-//				}
-//
-//				return exec.Command(path, ".", "-t", homeDir).Run()
-//			},
-//		},
-//		{
-//			Step: "Persisting Sync Details...",
-//			Action: func() error {
-//				//	syncStash := SyncStash{
-//				//		LastSyncType:   syncType,
-//				//		LastSyncTime:   time.Now().Format(time.RFC3339),
-//				//		LastSyncStatus: true,
-//				//	}
-//				//
-//				//	return s.db.Create(&syncStash)
-//				return nil
-//			},
-//		},
-//		{
-//			Step: "Finalizing Sync...",
-//			Action: func() error {
-//				return nil
-//			},
-//		},
-//	}
-//
-//	constant := 100 / len(steps)
-//	event := SyncEvent{
-//		Data: struct {
-//			Progress  int    `json:"progress"`
-//			IsSuccess bool   `json:"isSuccess"`
-//			Step      string `json:"step"`
-//			Error     string `json:"error"`
-//			Done      bool   `json:"done"`
-//		}{Progress: 0, IsSuccess: true, Done: false},
-//	}
-//
-//	notify(&Git{s.config}, s.brokerNotifier)
-//
-//	for i, step := range steps {
-//		event.Data.Step = step.Step
-//		err := step.Action()
-//		if err != nil {
-//			event.Data.IsSuccess = false
-//			event.Data.Error = err.Error()
-//			ch <- event
-//			return
-//		}
-//
-//		event.Data.IsSuccess = true
-//		event.Data.Progress += constant
-//		if i == len(steps)-1 { // on final step
-//			event.Data.Done = true
-//			progress := event.Data.Progress
-//			if progress != 100 {
-//				event.Data.Progress += 100 - progress
-//			}
-//		}
-//		ch <- event
-//		time.Sleep(time.Second)
-//	}
-//
-//	notify(&Git{s.config}, s.brokerNotifier)
-//	close(ch)
-//	ch = make(chan SyncEvent)
-//	s.mutex.Unlock()
-//}
-//
-//func (s *stowSyncer) Consume(ch chan SyncEvent, consumers ...Consumer) {
-//
-//	//if s.ch == nil {
-//	//	Error("No channel available")
-//	//	return
-//	//}
-//
-//	// default consumers
-//	consumers = append(consumers, func(event SyncEvent) {
-//		s.brokerNotifier.SyncEvent(event)
-//	})
-//
-//	for event := range ch {
-//		for _, consumer := range consumers {
-//			go consumer(event)
-//		}
-//		time.Sleep(1 * time.Second)
-//	}
-//
-//}
-//
-//func notify(git *Git, brokerNotifier *BrokerNotifier) {
-//	localCommit, err := git.LocalCommit()
-//	if err != nil {
-//		Error(err.Error())
-//		return
-//	}
-//
-//	remoteCommit, err := git.RemoteCommit()
-//	if err != nil {
-//		Error(err.Error())
-//		return
-//	}
-//
-//	response := InitGitTransform(localCommit, remoteCommit)
-//	brokerNotifier.SyncStatus(response)
-//}
+	config         *Configurations // Agent configuration
+	mutex          *sync.Mutex     // Mutex to prevent concurrent syncs
+	brokerNotifier *BrokerNotifier // Notifier for sending events to broker
+	git            *Git            // Git instance for repository operations
+}
+
+// NewStowSyncer creates a new stow syncer instance
+func NewStowSyncer(
+	config *Configurations,
+	brokerNotifier *BrokerNotifier,
+	mutex *sync.Mutex,
+	git *Git) Syncer {
+
+	return stowSyncer{
+		config:         config,
+		mutex:          mutex,
+		brokerNotifier: brokerNotifier,
+		git:            git,
+	}
+}
+
+// Sync pulls the repository and stows every package into the home directory.
+// Progress is reported to all registered consumers via SyncEvent messages.
+func (s stowSyncer) Sync(consumers ...Consumer) {
+	s.mutex.Lock()
+	ch := make(chan SyncEvent)
+
+	notify(&Git{s.config}, s.brokerNotifier)
+
+	go runSyncSteps(stowSyncSteps(s.config, s.git), s.config.Retry, ch)
+
+	// Add broker notifier as a consumer
+	consumers = append(consumers, func(event SyncEvent) {
+		s.brokerNotifier.SyncEvent(event)
+	})
+
+	// Send events to all consumers
+	for event := range ch {
+		for _, consumer := range consumers {
+			consumer(event)
+		}
+	}
+
+	notify(&Git{s.config}, s.brokerNotifier)
+	s.mutex.Unlock()
+}
+
+// Unstow removes the links of the given packages from the home directory.
+// When no package is given, every package in the repository is unstowed.
+func (s stowSyncer) Unstow(packages ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	repoDir := s.config.RepoPath()
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	if len(packages) == 0 {
+		packages, err = StowPackages(repoDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	stow, err := newStower(repoDir, homeDir)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range packages {
+		if err := stow.Unstow(pkg); err != nil {
+			return err
+		}
+	}
+
+	return stow.Apply()
+}
+
+// stowSyncSteps defines the sequence of operations for stow synchronization.
+func stowSyncSteps(config *Configurations, git *Git) []SyncStep {
+	var (
+		repoDir  = config.RepoPath()
+		packages []string
+	)
+
+	return []SyncStep{
+		{
+			Step:  "Git Repository checkout",
+			Retry: true,
+			Action: func() error {
+				return git.CloneOrPullRepository()
+			},
+		},
+		{
+			Step: "Resolve stow packages",
+			Action: func() error {
+				var err error
+				packages, err = StowPackages(repoDir)
+				if err != nil {
+					return err
+				}
+
+				if len(packages) == 0 {
+					return errors.New("no stow packages found in repository")
+				}
+
+				return nil
+			},
+		},
+		{
+			Step: "Stow packages into home directory",
+			Action: func() error {
+				homeDir, err := os.UserHomeDir()
+				if err != nil {
+					return fmt.Errorf("failed to get home directory: %w", err)
+				}
+
+				// Plan every package first so that a conflict leaves the home directory untouched
+				stow, err := newStower(repoDir, homeDir)
+				if err != nil {
+					return err
+				}
+				for _, pkg := range packages {
+					if err := stow.Stow(pkg); err != nil {
+						return err
+					}
+				}
+
+				if err := stow.Apply(); err != nil {
+					return err
+				}
+
+				for _, pkg := range packages {
+					Infoln(fmt.Sprintf("Stowed: %s -> %s", pkg, homeDir))
+				}
+
+				return nil
+			},
+		},
+	}
+}
+
+// StowPackages lists the stow packages of a repository: every top-level directory
+// that is not hidden (.git, .github, ...).
+func StowPackages(repoDir string) ([]string, error) {
+	entries, err := os.ReadDir(repoDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository: %w", err)
+	}
+
+	var packages []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		packages = append(packages, entry.Name())
+	}
+
+	return packages, nil
+}
+
+// stowIgnoreFile is the file of a package replacing the default ignore list, like in GNU stow
+const stowIgnoreFile = ".stow-local-ignore"
+
+// stowIgnoreList holds the patterns of a .stow-local-ignore file, one regular expression per
+// line. As in GNU stow, patterns containing a slash match the path from the package root
+// (/bin/setup), the others match whole entry names.
+type stowIgnoreList struct {
+	path    *regexp.Regexp // Patterns containing a slash, nil if there are none
+	segment *regexp.Regexp // Patterns matching entry names, nil if there are none
+}
+
+// readStowIgnore reads the .stow-local-ignore file of a package directory.
+// It returns nil if the package has none, so the default ignore list applies.
+func readStowIgnore(pkgDir string) (*stowIgnoreList, error) {
+	content, err := os.ReadFile(filepath.Join(pkgDir, stowIgnoreFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths, segments []string
+	for _, line := range strings.Split(string(content), "\n") {
+		// Comments start with an unescaped #, \# is a literal #
+		line = strings.TrimSpace(stowIgnoreComment.ReplaceAllString(line, "$1"))
+		if line == "" {
+			continue
+		}
+
+		if _, err := regexp.Compile(line); err != nil {
+			return nil, fmt.Errorf("invalid pattern in %s: %w", filepath.Join(pkgDir, stowIgnoreFile), err)
+		}
+
+		if strings.Contains(line, "/") {
+			paths = append(paths, line)
+		} else {
+			segments = append(segments, line)
+		}
+	}
+
+	list := &stowIgnoreList{}
+	if len(paths) > 0 {
+		list.path = regexp.MustCompile(`(^|/)(` + strings.Join(paths, "|") + `)(/|$)`)
+	}
+	if len(segments) > 0 {
+		list.segment = regexp.MustCompile(`^(` + strings.Join(segments, "|") + `)$`)
+	}
+	return list, nil
+}
+
+// stowIgnoreComment matches the comment of a .stow-local-ignore line, keeping what precedes it
+var stowIgnoreComment = regexp.MustCompile(`^((?:[^\\#]|\\.)*)#.*$`)
+
+// Match reports whether a path relative to the package root is ignored
+func (l *stowIgnoreList) Match(rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if l.path != nil && l.path.MatchString("/"+rel) {
+		return true
+	}
+	return l.segment != nil && l.segment.MatchString(path.Base(rel))
+}
+
+// stowIgnore reports whether a package entry should never be linked.
+// Mirrors the default ignore list of GNU stow.
+func stowIgnore(name string, packageRoot bool) bool {
+	switch name {
+	case ".git", ".gitignore", ".gitmodules", ".DS_Store", "CVS", "RCS":
+		return true
+	}
+
+	if strings.HasSuffix(name, "~") || (strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#")) {
+		return true
+	}
+
+	if packageRoot {
+		for _, prefix := range []string{"README", "LICENSE", "COPYING"} {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// stowNodeKind is the kind of filesystem node found at a target path
+type stowNodeKind int
+
+const (
+	stowMissing stowNodeKind = iota
+	stowDir
+	stowLink
+	stowFile
+)
+
+// stowNode describes a target path, taking pending operations into account
+type stowNode struct {
+	kind stowNodeKind
+	dest string // Absolute destination for links
+}
+
+// stowTask is a single filesystem operation scheduled by the stower
+type stowTask struct {
+	op     string // "link", "unlink", "mkdir" or "rmdir"
+	path   string // Target path the operation applies to
+	source string // Link text for "link" operations
+}
+
+// stower plans stow and unstow operations against a target directory.
+// Operations are only recorded while planning and executed by Apply, so that
+// conflicts are reported before anything in the target directory is modified.
+type stower struct {
+	repoDir   string
+	targetDir string
+	tasks     []stowTask
+	pending   map[string]stowNode // Planned state of paths touched by tasks
+	conflicts []string
+	ignores   map[string]*stowIgnoreList // .stow-local-ignore of each loaded package, nil for the default list
+}
+
+// newStower creates a stower linking packages of repoDir into targetDir. Both directories
+// are made absolute, so that links relative to their target point into the repository.
+func newStower(repoDir, targetDir string) (*stower, error) {
+	repoDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	targetDir, err = filepath.Abs(targetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stower{
+		repoDir:   repoDir,
+		targetDir: targetDir,
+		pending:   make(map[string]stowNode),
+		ignores:   make(map[string]*stowIgnoreList),
+	}, nil
+}
+
+// Stow plans linking the contents of a package into the target directory.
+// Conflicts are collected and reported by Apply.
+func (s *stower) Stow(pkg string) error {
+	pkgDir := filepath.Join(s.repoDir, pkg)
+	if info, err := os.Stat(pkgDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("stow package %s does not exist", pkg)
+	}
+
+	if err := s.loadIgnore(pkg); err != nil {
+		return err
+	}
+
+	return s.stowContents(pkg, pkgDir, s.targetDir)
+}
+
+// Unstow plans removing the links of a package from the target directory
+func (s *stower) Unstow(pkg string) error {
+	pkgDir := filepath.Join(s.repoDir, pkg)
+	if info, err := os.Stat(pkgDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("stow package %s does not exist", pkg)
+	}
+
+	if err := s.loadIgnore(pkg); err != nil {
+		return err
+	}
+
+	return s.unstowContents(pkg, pkgDir, s.targetDir)
+}
+
+// loadIgnore reads the .stow-local-ignore of a package once
+func (s *stower) loadIgnore(pkg string) error {
+	if _, ok := s.ignores[pkg]; ok {
+		return nil
+	}
+
+	list, err := readStowIgnore(filepath.Join(s.repoDir, pkg))
+	if err != nil {
+		return err
+	}
+	s.ignores[pkg] = list
+	return nil
+}
+
+// ignored reports whether a path of the repository is never linked: an entry of the default
+// ignore list, or of the package's .stow-local-ignore. loadIgnore must have been called for
+// its package.
+func (s *stower) ignored(source string) bool {
+	rel, err := filepath.Rel(s.repoDir, source)
+	if err != nil {
+		return false
+	}
+	pkg, rel, _ := strings.Cut(filepath.ToSlash(rel), "/")
+
+	if rel == stowIgnoreFile {
+		return true
+	}
+	if list := s.ignores[pkg]; list != nil {
+		return list.Match(rel)
+	}
+	return stowIgnore(path.Base(rel), !strings.Contains(rel, "/"))
+}
+
+// Apply executes the planned operations in order
+func (s *stower) Apply() error {
+	if err := s.conflictError(); err != nil {
+		return err
+	}
+
+	for _, task := range s.tasks {
+		var err error
+		switch task.op {
+		case "link":
+			err = os.Symlink(task.source, task.path)
+		case "unlink":
+			err = os.Remove(task.path)
+		case "mkdir":
+			err = os.Mkdir(task.path, os.ModePerm)
+		case "rmdir":
+			err = os.Remove(task.path)
+		}
+
+		if err != nil {
+			return fmt.Errorf("stow %s %s failed: %w", task.op, task.path, err)
+		}
+	}
+
+	s.tasks = nil
+	s.pending = make(map[string]stowNode)
+	return nil
+}
+
+// conflictError returns an error describing all conflicts found while planning
+func (s *stower) conflictError() error {
+	if len(s.conflicts) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("stow conflicts detected, nothing was changed:\n  %s", strings.Join(s.conflicts, "\n  "))
+}
+
+// stowContents links every entry of source directory into the target directory
+func (s *stower) stowContents(pkg, source, target string) error {
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if s.ignored(filepath.Join(source, entry.Name())) {
+			continue
+		}
+
+		if err := s.stowNode(pkg, filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stowNode links a single source path to a target path, unfolding existing
+// folded directories owned by another package when needed.
+func (s *stower) stowNode(pkg, source, target string) error {
+	node := s.lookup(target)
+	sourceIsDir := isDir(source)
+
+	switch node.kind {
+	case stowMissing:
+		return s.link(source, target)
+
+	case stowLink:
+		if node.dest == source {
+			return nil // already stowed
+		}
+
+		if !s.owned(node.dest) {
+			s.conflict(pkg, target, "existing target is not owned by stow")
+			return nil
+		}
+
+		if _, err := os.Stat(node.dest); err != nil {
+			// Stale link left behind by a package that was removed from the repository
+			s.add(stowTask{op: "unlink", path: target}, stowNode{kind: stowMissing})
+			return s.link(source, target)
+		}
+
+		if !sourceIsDir || !isDir(node.dest) {
+			s.conflict(pkg, target, "existing target is stowed to a different package: "+s.rel(node.dest))
+			return nil
+		}
+
+		// Unfold the tree: replace the link with a real directory holding links
+		// to the contents of the previously linked directory, except its ignored entries
+		owner, _, _ := strings.Cut(filepath.ToSlash(s.rel(node.dest)), "/")
+		if err := s.loadIgnore(owner); err != nil {
+			return err
+		}
+		s.add(stowTask{op: "unlink", path: target}, stowNode{kind: stowMissing})
+		s.add(stowTask{op: "mkdir", path: target}, stowNode{kind: stowDir})
+		entries, err := os.ReadDir(node.dest)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if s.ignored(filepath.Join(node.dest, entry.Name())) {
+				continue
+			}
+			if err := s.link(filepath.Join(node.dest, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+				return err
+			}
+		}
+
+		return s.stowContents(pkg, source, target)
+
+	case stowDir:
+		if !sourceIsDir {
+			s.conflict(pkg, target, "existing target is a directory")
+			return nil
+		}
+
+		return s.stowContents(pkg, source, target)
+
+	case stowFile:
+		s.conflict(pkg, target, "existing target is neither a link nor a directory")
+	}
+
+	return nil
+}
+
+// unstowContents removes the links of every entry of the source directory
+func (s *stower) unstowContents(pkg, source, target string) error {
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if s.ignored(filepath.Join(source, entry.Name())) {
+			continue
+		}
+
+		if err := s.unstowNode(pkg, filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unstowNode removes the link for a single source path and refolds
+// directories that only contain links into a single package directory.
+func (s *stower) unstowNode(pkg, source, target string) error {
+	node := s.lookup(target)
+
+	switch node.kind {
+	case stowLink:
+		if node.dest == source {
+			s.add(stowTask{op: "unlink", path: target}, stowNode{kind: stowMissing})
+		}
+
+	case stowDir:
+		if !isDir(source) {
+			return nil
+		}
+
+		if err := s.unstowContents(pkg, source, target); err != nil {
+			return err
+		}
+
+		return s.fold(target)
+	}
+
+	return nil
+}
+
+// fold replaces a directory whose entries all link into the same package
+// directory with a single link to that directory.
+func (s *stower) fold(target string) error {
+	names := s.readDir(target)
+	if len(names) == 0 {
+		return nil
+	}
+
+	parent := ""
+	for _, name := range names {
+		node := s.lookup(filepath.Join(target, name))
+		if node.kind != stowLink || !s.owned(node.dest) {
+			return nil
+		}
+
+		dir := filepath.Dir(node.dest)
+		if parent != "" && parent != dir {
+			return nil
+		}
+		parent = dir
+	}
+
+	if parent == s.repoDir || !s.owned(parent) {
+		return nil
+	}
+
+	for _, name := range names {
+		s.add(stowTask{op: "unlink", path: filepath.Join(target, name)}, stowNode{kind: stowMissing})
+	}
+	s.add(stowTask{op: "rmdir", path: target}, stowNode{kind: stowMissing})
+	return s.link(parent, target)
+}
+
+// link schedules a relative symlink from target to source
+func (s *stower) link(source, target string) error {
+	linkText, err := filepath.Rel(filepath.Dir(target), source)
+	if err != nil {
+		return fmt.Errorf("failed to link %s to %s: %w", target, source, err)
+	}
+
+	s.add(stowTask{op: "link", path: target, source: linkText}, stowNode{kind: stowLink, dest: source})
+	return nil
+}
+
+// add records a task and the state it leaves the target path in
+func (s *stower) add(task stowTask, node stowNode) {
+	s.tasks = append(s.tasks, task)
+	s.pending[task.path] = node
+}
+
+// conflict records a conflict for a target path
+func (s *stower) conflict(pkg, target, reason string) {
+	s.conflicts = append(s.conflicts, fmt.Sprintf("%s: %s (package %s)", target, reason, pkg))
+}
+
+// lookup returns the state of a target path, including planned operations
+func (s *stower) lookup(target string) stowNode {
+	if node, ok := s.pending[target]; ok {
+		return node
+	}
+
+	info, err := os.Lstat(target)
+	if err != nil {
+		return stowNode{kind: stowMissing}
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		dest, err := os.Readlink(target)
+		if err != nil {
+			return stowNode{kind: stowFile}
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(filepath.Dir(target), dest)
+		}
+		return stowNode{kind: stowLink, dest: filepath.Clean(dest)}
+	case info.IsDir():
+		return stowNode{kind: stowDir}
+	default:
+		return stowNode{kind: stowFile}
+	}
+}
+
+// readDir lists the entries of a target directory, including planned operations
+func (s *stower) readDir(target string) []string {
+	seen := make(map[string]bool)
+	if entries, err := os.ReadDir(target); err == nil {
+		for _, entry := range entries {
+			seen[entry.Name()] = true
+		}
+	}
+
+	for p := range s.pending {
+		if filepath.Dir(p) == target {
+			seen[filepath.Base(p)] = true
+		}
+	}
+
+	var names []string
+	for name := range seen {
+		if s.lookup(filepath.Join(target, name)).kind != stowMissing {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// owned reports whether a path lives inside the stow repository
+func (s *stower) owned(p string) bool {
+	return strings.HasPrefix(p, s.repoDir+string(os.PathSeparator))
+}
+
+// rel returns a path relative to the stow repository for messages
+func (s *stower) rel(p string) string {
+	if r, err := filepath.Rel(s.repoDir, p); err == nil {
+		return r
+	}
+	return p
+}
+
+// isDir reports whether a path is a directory, following symlinks
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files under dir, with directories as needed
+func writeFiles(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		p := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// stowTestDirs returns a repository and a home directory for stow tests
+func stowTestDirs(t *testing.T) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	repo, home := filepath.Join(root, "repo"), filepath.Join(root, "home")
+	for _, dir := range []string{repo, home} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo, home
+}
+
+// stowPackages plans stowing packages into home and applies the plan
+func stowPackages(repo, home string, packages ...string) error {
+	stow, err := newStower(repo, home)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range packages {
+		if err := stow.Stow(pkg); err != nil {
+			return err
+		}
+	}
+	return stow.Apply()
+}
+
+// unstowPackages plans unstowing packages from home and applies the plan
+func unstowPackages(repo, home string, packages ...string) error {
+	stow, err := newStower(repo, home)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range packages {
+		if err := stow.Unstow(pkg); err != nil {
+			return err
+		}
+	}
+	return stow.Apply()
+}
+
+// assertLink fails unless target is a symlink to dest
+func assertLink(t *testing.T, target, dest string) {
+	t.Helper()
+	link, err := os.Readlink(target)
+	if err != nil {
+		t.Fatalf("%s is not a link: %v", target, err)
+	}
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(target), link)
+	}
+	if filepath.Clean(link) != dest {
+		t.Fatalf("%s links to %s, want %s", target, link, dest)
+	}
+}
+
+// assertDir fails unless target is a real directory
+func assertDir(t *testing.T, target string) {
+	t.Helper()
+	info, err := os.Lstat(target)
+	if err != nil || !info.IsDir() {
+		t.Fatalf("%s is not a directory: %v", target, err)
+	}
+}
+
+// assertMissing fails unless nothing exists at target
+func assertMissing(t *testing.T, target string) {
+	t.Helper()
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Fatalf("%s exists, want it missing", target)
+	}
+}
+
+func TestStowFoldsDirectories(t *testing.T) {
+	repo, home := stowTestDirs(t)
+	writeFiles(t, repo, "vim/.vimrc", "vim/.config/nvim/init.vim", "vim/README.md")
+
+	if err := stowPackages(repo, home, "vim"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertLink(t, filepath.Join(home, ".vimrc"), filepath.Join(repo, "vim/.vimrc"))
+	assertLink(t, filepath.Join(home, ".config"), filepath.Join(repo, "vim/.config"))
+	assertMissing(t, filepath.Join(home, "README.md"))
+
+	// Stowing again changes nothing
+	if err := stowPackages(repo, home, "vim"); err != nil {
+		t.Fatal(err)
+	}
+	assertLink(t, filepath.Join(home, ".config"), filepath.Join(repo, "vim/.config"))
+}
+
+func TestStowRelativeRepository(t *testing.T) {
+	repo, home := stowTestDirs(t)
+	writeFiles(t, repo, "zsh/.zshrc")
+
+	chdir(t, filepath.Dir(repo))
+
+	if err := stowPackages(filepath.Base(repo), home, "zsh"); err != nil {
+		t.Fatal(err)
+	}
+	assertLink(t, filepath.Join(home, ".zshrc"), filepath.Join(repo, "zsh/.zshrc"))
+	if _, err := os.Stat(filepath.Join(home, ".zshrc")); err != nil {
+		t.Fatalf("link is dangling: %v", err)
+	}
+
+	// The links are recognised as owned on the next sync
+	if err := stowPackages(filepath.Base(repo), home, "zsh"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStowUnfoldsAndRefolds(t *testing.T) {
+	repo, home := stowTestDirs(t)
+	writeFiles(t, repo, "vim/.config/nvim/init.vim", "git/.config/git/config")
+
+	if err := stowPackages(repo, home, "vim"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stowPackages(repo, home, "git"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertDir(t, filepath.Join(home, ".config"))
+	assertLink(t, filepath.Join(home, ".config/nvim"), filepath.Join(repo, "vim/.config/nvim"))
+	assertLink(t, filepath.Join(home, ".config/git"), filepath.Join(repo, "git/.config/git"))
+
+	if err := unstowPackages(repo, home, "git"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertLink(t, filepath.Join(home, ".config"), filepath.Join(repo, "vim/.config"))
+}
+
+func TestStowUnstowKeepsForeignFiles(t *testing.T) {
+	repo, home := stowTestDirs(t)
+	writeFiles(t, repo, "vim/.config/nvim/init.vim")
+	writeFiles(t, home, ".config/user.conf")
+
+	if err := stowPackages(repo, home, "vim"); err != nil {
+		t.Fatal(err)
+	}
+	assertLink(t, filepath.Join(home, ".config/nvim"), filepath.Join(repo, "vim/.config/nvim"))
+
+	if err := unstowPackages(repo, home, "vim"); err != nil {
+		t.Fatal(err)
+	}
+	assertMissing(t, filepath.Join(home, ".config/nvim"))
+	assertDir(t, filepath.Join(home, ".config"))
+}
+
+func TestStowConflicts(t *testing.T) {
+	outside := t.TempDir()
+	writeFiles(t, outside, "nvim/init.vim")
+
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, repo, home string)
+		reason string
+	}{
+		{
+			name: "existing file",
+			setup: func(t *testing.T, repo, home string) {
+				writeFiles(t, home, ".vimrc")
+			},
+			reason: "existing target is neither a link nor a directory",
+		},
+		{
+			name: "link not owned by the repository",
+			setup: func(t *testing.T, repo, home string) {
+				if err := os.Symlink(filepath.Join(outside, "nvim"), filepath.Join(home, ".vimrc")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			reason: "existing target is not owned by stow",
+		},
+		{
+			name: "file stowed by another package",
+			setup: func(t *testing.T, repo, home string) {
+				writeFiles(t, repo, "other/.vimrc")
+				if err := stowPackages(repo, home, "other"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			reason: "existing target is stowed to a different package: other/.vimrc",
+		},
+		{
+			name: "directory where a file is stowed",
+			setup: func(t *testing.T, repo, home string) {
+				writeFiles(t, home, ".vimrc/keep")
+			},
+			reason: "existing target is a directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, home := stowTestDirs(t)
+			writeFiles(t, repo, "vim/.vimrc", "vim/.gvimrc")
+			test.setup(t, repo, home)
+
+			err := stowPackages(repo, home, "vim")
+			if err == nil || !strings.Contains(err.Error(), test.reason) {
+				t.Fatalf("got error %v, want %q", err, test.reason)
+			}
+
+			// Nothing is linked when a conflict is found
+			assertMissing(t, filepath.Join(home, ".gvimrc"))
+		})
+	}
+}
+
+func TestStowReplacesStaleLinks(t *testing.T) {
+	repo, home := stowTestDirs(t)
+	writeFiles(t, repo, "vim/.vimrc")
+	if err := os.Symlink(filepath.Join(repo, "removed/.vimrc"), filepath.Join(home, ".vimrc")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stowPackages(repo, home, "vim"); err != nil {
+		t.Fatal(err)
+	}
+	assertLink(t, filepath.Join(home, ".vimrc"), filepath.Join(repo, "vim/.vimrc"))
+}
+
+func TestStowOwned(t *testing.T) {
+	stow, err := newStower("/srv/dotfiles", "/home/user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		owned bool
+	}{
+		{"/srv/dotfiles/vim/.vimrc", true},
+		{"/srv/dotfiles/vim", true},
+		{"/srv/dotfiles", false},
+		{"/srv/dotfiles-other/vim/.vimrc", false},
+		{"/home/user/.vimrc", false},
+	}
+
+	for _, test := range tests {
+		if got := stow.owned(test.path); got != test.owned {
+			t.Errorf("owned(%s) = %v, want %v", test.path, got, test.owned)
+		}
+	}
+}
+
+func TestStowLocalIgnore(t *testing.T) {
+	repo, home := stowTestDirs(t)
+	writeFiles(t, repo,
+		"vim/.stow-local-ignore",
+		"vim/.vimrc",
+		"vim/README.md",
+		"vim/notes.txt",
+		"vim/.vim/undo/file",
+		"vim/.vim/colors/theme.vim",
+		"vim/install.sh",
+	)
+	ignore := "# local files\n" +
+		"notes\\.txt  # trailing comment\n" +
+		"\n" +
+		"^/install\\.sh\n" +
+		"/\\.vim/undo\n"
+	if err := os.WriteFile(filepath.Join(repo, "vim", stowIgnoreFile), []byte(ignore), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep .vim unfolded so that its entries are linked one by one
+	writeFiles(t, home, ".vim/keep")
+
+	if err := stowPackages(repo, home, "vim"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertLink(t, filepath.Join(home, ".vimrc"), filepath.Join(repo, "vim/.vimrc"))
+	assertLink(t, filepath.Join(home, ".vim/colors"), filepath.Join(repo, "vim/.vim/colors"))
+	// The local ignore list replaces the default one
+	assertLink(t, filepath.Join(home, "README.md"), filepath.Join(repo, "vim/README.md"))
+	assertMissing(t, filepath.Join(home, stowIgnoreFile))
+	assertMissing(t, filepath.Join(home, "notes.txt"))
+	assertMissing(t, filepath.Join(home, "install.sh"))
+	assertMissing(t, filepath.Join(home, ".vim/undo"))
+}
+
+func TestStowLocalIgnoreInvalidPattern(t *testing.T) {
+	repo, home := stowTestDirs(t)
+	writeFiles(t, repo, "vim/.vimrc")
+	if err := os.WriteFile(filepath.Join(repo, "vim", stowIgnoreFile), []byte("(unclosed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stowPackages(repo, home, "vim"); err == nil {
+		t.Fatal("expected an error for an invalid pattern")
+	}
+}
+
+func TestStowUnfoldSkipsIgnoredEntries(t *testing.T) {
+	repo, home := stowTestDirs(t)
+	writeFiles(t, repo,
+		"vim/.config/nvim/init.vim",
+		"vim/.config/secret.txt",
+		"vim/.config/notes~",
+		"git/.config/git/config",
+	)
+	if err := os.WriteFile(filepath.Join(repo, "vim", stowIgnoreFile), []byte("secret\\.txt\n.+~\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stowPackages(repo, home, "vim"); err != nil {
+		t.Fatal(err)
+	}
+	assertLink(t, filepath.Join(home, ".config"), filepath.Join(repo, "vim/.config"))
+
+	// Stowing git unfolds .config, relinking only the entries vim does not ignore
+	if err := stowPackages(repo, home, "git"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertDir(t, filepath.Join(home, ".config"))
+	assertLink(t, filepath.Join(home, ".config/nvim"), filepath.Join(repo, "vim/.config/nvim"))
+	assertLink(t, filepath.Join(home, ".config/git"), filepath.Join(repo, "git/.config/git"))
+	assertMissing(t, filepath.Join(home, ".config/secret.txt"))
+	assertMissing(t, filepath.Join(home, ".config/notes~"))
+}
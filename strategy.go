@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SyncerConstructor creates a Syncer implementing a sync strategy
+type SyncerConstructor func(
+	config *Configurations,
+	brokerNotifier *BrokerNotifier,
+	mutex *sync.Mutex,
+	git *Git) Syncer
+
+// syncers is the registry of available sync strategies
+var syncers = map[string]SyncerConstructor{
+	EnhancedStrategy: NewEnhancedSyncer,
+	LegacyStrategy:   NewCustomerSyncer,
+	StowStrategy:     NewStowSyncer,
+}
+
+// RegisterSyncer adds a sync strategy to the registry, replacing any existing one with the same name
+func RegisterSyncer(strategy string, constructor SyncerConstructor) {
+	syncers[strategy] = constructor
+}
+
+// Strategies returns the names of all registered sync strategies, including auto detection
+func Strategies() []string {
+	names := []string{AutoStrategy}
+	for name := range syncers {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	return names
+}
+
+// ValidateStrategy returns an error if the strategy is neither registered nor auto
+func ValidateStrategy(strategy string) error {
+	if strategy == AutoStrategy {
+		return nil
+	}
+
+	if _, ok := syncers[strategy]; !ok {
+		return fmt.Errorf("unknown sync strategy %q (available: %s)", strategy, strings.Join(Strategies(), ", "))
+	}
+
+	return nil
+}
+
+// NewSyncer creates the Syncer registered for a strategy.
+// The auto strategy returns a Syncer that detects the strategy on every sync.
+func NewSyncer(
+	strategy string,
+	config *Configurations,
+	brokerNotifier *BrokerNotifier,
+	mutex *sync.Mutex,
+	git *Git) (Syncer, error) {
+
+	if err := ValidateStrategy(strategy); err != nil {
+		return nil, err
+	}
+
+	if strategy == AutoStrategy {
+		return autoSync{
+			config:         config,
+			mutex:          mutex,
+			brokerNotifier: brokerNotifier,
+			git:            git,
+		}, nil
+	}
+
+	return syncers[strategy](config, brokerNotifier, mutex, git), nil
+}
+
+// DetectStrategy picks the sync strategy for a repository checkout:
+//   - the `strategy:` key of dotfile-config.yaml, when present
+//   - enhanced, when dotfile-config.yaml has a top-level `dotfiles:` key
+//   - legacy, for any other dotfile-config.yaml
+//   - stow, when the repository has no dotfile-config.yaml
+func DetectStrategy(repoDir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(repoDir, DotfileConfigName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			Infoln("No", DotfileConfigName, "in the repository, syncing top-level directories as stow packages")
+			return StowStrategy, nil
+		}
+		return "", err
+	}
+
+	var rawData map[string]interface{}
+	if err := yaml.Unmarshal(data, &rawData); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", DotfileConfigName, err)
+	}
+
+	if strategy, ok := rawData["strategy"].(string); ok && strategy != AutoStrategy {
+		if err := ValidateStrategy(strategy); err != nil {
+			return "", err
+		}
+		return strategy, nil
+	}
+
+	if _, ok := rawData["dotfiles"]; ok {
+		return EnhancedStrategy, nil
+	}
+
+	return LegacyStrategy, nil
+}
+
+// autoSync implements the Syncer interface by detecting the strategy of the
+// repository before every sync and delegating to the matching Syncer.
+type autoSync struct {
+	config         *Configurations // Agent configuration
+	mutex          *sync.Mutex     // Mutex shared with the delegated syncers
+	brokerNotifier *BrokerNotifier // Notifier for sending events to broker
+	git            *Git            // Git instance for repository operations
+}
+
+// Sync pulls the repository, detects the strategy of the pulled checkout and runs the
+// matching syncer, all while holding the sync mutex, so that a commit switching formats
+// is synced with its new strategy. The syncer is given a mutex of its own, as this one is
+// held for the whole sync; its checkout step finds the repository up to date.
+// When the pull fails, the failure is reported to the consumers and nothing is synced.
+func (a autoSync) Sync(consumers ...Consumer) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	const checkoutStep = "Git Repository checkout"
+	if err := a.config.Retry.Do(a.git.CloneOrPullRepository, logRetry(checkoutStep)); err != nil {
+		Error("Unable to pull repository for strategy detection:", err.Error())
+		a.fail(checkoutStep, err, consumers...)
+		return
+	}
+
+	strategy, err := DetectStrategy(a.config.RepoPath())
+	if err != nil {
+		Error("Unable to detect sync strategy:", err.Error(), "- falling back to", EnhancedStrategy)
+		strategy = EnhancedStrategy
+	}
+
+	Infoln("Sync strategy ->", strategy)
+	syncers[strategy](a.config, a.brokerNotifier, &sync.Mutex{}, a.git).Sync(consumers...)
+}
+
+// fail reports a sync that failed at a step to the consumers and the broker
+func (a autoSync) fail(step string, cause error, consumers ...Consumer) {
+	ch := make(chan SyncEvent)
+	go runSyncSteps([]SyncStep{{Step: step, Action: func() error { return cause }}}, a.config.Retry, ch)
+
+	consumers = append(consumers, func(event SyncEvent) {
+		a.brokerNotifier.SyncEvent(event)
+	})
+
+	for event := range ch {
+		for _, consumer := range consumers {
+			consumer(event)
+		}
+	}
+}
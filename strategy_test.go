@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDetectStrategy(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string // Content of dotfile-config.yaml, empty for none
+		want   string
+		err    string
+	}{
+		{name: "no config", want: StowStrategy},
+		{name: "enhanced", config: "dotfiles:\n  - software: zsh\n", want: EnhancedStrategy},
+		{name: "legacy", config: "zsh:\n  - .zshrc\n", want: LegacyStrategy},
+		{name: "explicit strategy", config: "strategy: stow\ndotfiles: []\n", want: StowStrategy},
+		{name: "unknown strategy", config: "strategy: rsync\n", err: "rsync"},
+		{name: "invalid yaml", config: "dotfiles: [\n", err: "failed to parse"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := t.TempDir()
+			if test.config != "" {
+				if err := os.WriteFile(filepath.Join(repo, DotfileConfigName), []byte(test.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			strategy, err := DetectStrategy(repo)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strategy != test.want {
+				t.Errorf("got strategy %s, want %s", strategy, test.want)
+			}
+		})
+	}
+}
+
+func TestAutoSyncStopsWhenPullFails(t *testing.T) {
+	config := gitTestConfig(t, "file://"+filepath.Join(t.TempDir(), "missing.git"), DefaultRef)
+	config.Retry = RetryPolicy{Attempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	mutex := &sync.Mutex{}
+	syncer := autoSync{config: config, mutex: mutex, brokerNotifier: &BrokerNotifier{}, git: &Git{config}}
+
+	var events []SyncEvent
+	syncer.Sync(func(event SyncEvent) {
+		events = append(events, event)
+	})
+
+	// The start of the sync and the failure: no delegated syncer retries the pull again
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if step := events[1].Data.Step; step != "Git Repository checkout" {
+		t.Errorf("failed at step %q, want the checkout", step)
+	}
+
+	last := events[len(events)-1].Data
+	if last.IsSuccess || last.Done || !strings.Contains(last.Error, "failed to clone") {
+		t.Errorf("last event %+v, want the clone failure", last)
+	}
+	if _, err := os.Stat(config.RepoPath()); err == nil {
+		t.Error("repository created despite the failed clone")
+	}
+
+	if !mutex.TryLock() {
+		t.Error("sync mutex still held")
+	}
+}
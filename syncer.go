@@ -1,5 +1,11 @@
 package main
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 // Syncer defines the interface for dotfile synchronization implementations.
 // Different syncers can implement different strategies (custom, stow, etc.)
 type Syncer interface {
@@ -15,10 +21,80 @@ type Consumer func(syncEvent SyncEvent)
 type SyncEvent struct {
 	// Data contains the current state of the sync operation
 	Data struct {
-		Progress  int    `json:"progress"`  // Percentage complete (0-100)
-		IsSuccess bool   `json:"isSuccess"` // Whether the current step succeeded
-		Step      string `json:"step"`      // Description of current step
-		Error     string `json:"error"`     // Error message if IsSuccess is false
-		Done      bool   `json:"done"`      // Whether the entire sync is complete
+		Progress    int    `json:"progress"`              // Percentage complete (0-100)
+		IsSuccess   bool   `json:"isSuccess"`             // Whether the current step succeeded
+		Step        string `json:"step"`                  // Description of current step
+		Error       string `json:"error"`                 // Error message if IsSuccess is false
+		Done        bool   `json:"done"`                  // Whether the entire sync is complete
+		Attempt     int    `json:"attempt,omitempty"`     // Attempt number when the current step is being retried
+		MaxAttempts int    `json:"maxAttempts,omitempty"` // Total attempts allowed for the current step
+		Output      string `json:"output,omitempty"`      // Line of command output produced by the current step
 	} `json:"data"`
 }
+
+// SyncStep is a single operation of a sync, reported to consumers by its description
+type SyncStep struct {
+	Step   string                               // Description of the step
+	Action func() error                         // Work performed by the step
+	Stream func(output func(line string)) error // Alternative to Action for steps streaming command output
+	Retry  bool                                 // Whether the step talks to the network and is retried on failure
+}
+
+// runSyncSteps executes steps in order and sends progress events to ch, closing it when done.
+// Steps marked with Retry are retried according to the retry policy; every retry is
+// reported as an event carrying the attempt number. Output of streaming steps is sent
+// as events carrying one line each. Execution stops at the first failing step.
+func runSyncSteps(steps []SyncStep, retry RetryPolicy, ch chan<- SyncEvent) {
+	constant := 100 / len(steps)
+	event := SyncEvent{}
+	event.Data.IsSuccess = true
+
+	ch <- event
+
+	for i, step := range steps {
+		event.Data.Step = step.Step
+
+		var err error
+		if step.Stream != nil {
+			err = step.Stream(func(line string) {
+				if strings.TrimSpace(line) == "" {
+					return
+				}
+				outputEvent := event
+				outputEvent.Data.Output = line
+				ch <- outputEvent
+			})
+		} else if step.Retry {
+			err = retry.Do(step.Action, func(attempt int, attempts int, cause error, delay time.Duration) {
+				retryEvent := event
+				retryEvent.Data.Step = fmt.Sprintf("%s: retrying (%d/%d)", step.Step, attempt, attempts)
+				retryEvent.Data.Error = cause.Error()
+				retryEvent.Data.Attempt = attempt
+				retryEvent.Data.MaxAttempts = attempts
+				ch <- retryEvent
+			})
+		} else {
+			err = step.Action()
+		}
+
+		if err != nil {
+			event.Data.IsSuccess = false
+			event.Data.Error = err.Error()
+			ch <- event
+			break
+		}
+
+		event.Data.IsSuccess = true
+		event.Data.Progress += constant
+		if i == len(steps)-1 { // on final step
+			event.Data.Done = true
+			progress := event.Data.Progress
+			if progress != 100 {
+				event.Data.Progress += 100 - progress
+			}
+		}
+		ch <- event
+	}
+
+	close(ch)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	stagedSuffix = ".dotfile-agent-staged" // Suffix of files staged next to their destination
+	backupSuffix = ".dotfile-agent-backup" // Suffix of destinations replaced during commit
+)
+
+// deployOp is a single change made by a deploy transaction
+type deployOp struct {
+	dir       bool   // Directory created while staging
+	dest      string // Destination path
+	staged    string // Staged copy of the source, for files
+	backup    string // Previous destination moved aside during commit, for files
+	backedUp  bool   // Whether dest existed and was moved to backup
+	committed bool   // Whether the staged copy was moved to dest
+}
+
+// deployTransaction copies dotfiles into place all-or-nothing.
+// Sources are first staged next to their destination, then swapped in by Commit.
+// If anything fails, Rollback restores every destination touched by the transaction.
+type deployTransaction struct {
+	ops []*deployOp
+}
+
+// newDeployTransaction creates an empty deploy transaction
+func newDeployTransaction() *deployTransaction {
+	return &deployTransaction{}
+}
+
+// Stage copies a file or directory tree next to its destination without
+// touching existing destination files. Missing directories are created and
+// recorded so they can be removed on rollback.
+func (t *deployTransaction) Stage(src, dest string) error {
+	if err := t.mkdirAll(filepath.Dir(dest)); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		if entry.IsDir() {
+			return t.mkdir(target)
+		}
+
+		return t.stageFile(p, target)
+	})
+}
+
+// Commit swaps every staged file into its destination, keeping the previous
+// destination as a backup until all files are in place.
+func (t *deployTransaction) Commit() error {
+	for _, op := range t.ops {
+		if op.dir {
+			continue
+		}
+
+		if _, err := os.Lstat(op.dest); err == nil {
+			op.backup = op.dest + backupSuffix
+			if err := os.RemoveAll(op.backup); err != nil {
+				return err
+			}
+			if err := os.Rename(op.dest, op.backup); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", op.dest, err)
+			}
+			op.backedUp = true
+		}
+
+		if err := os.Rename(op.staged, op.dest); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", op.dest, err)
+		}
+		op.committed = true
+	}
+
+	// Every file is in place, backups are no longer needed
+	for _, op := range t.ops {
+		if op.backedUp {
+			if err := os.RemoveAll(op.backup); err != nil {
+				Error("Failed to remove backup", op.backup, err.Error())
+			}
+		}
+	}
+
+	t.ops = nil
+	return nil
+}
+
+// Rollback undoes every change made by the transaction in reverse order
+func (t *deployTransaction) Rollback() error {
+	var errs []error
+
+	for i := len(t.ops) - 1; i >= 0; i-- {
+		op := t.ops[i]
+
+		if op.dir {
+			if err := os.Remove(op.dest); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if op.committed {
+			if err := os.RemoveAll(op.dest); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		} else if err := os.RemoveAll(op.staged); err != nil {
+			errs = append(errs, err)
+		}
+
+		if op.backedUp {
+			if err := os.Rename(op.backup, op.dest); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s: %w", op.dest, err))
+			}
+		}
+	}
+
+	t.ops = nil
+	return errors.Join(errs...)
+}
+
+// Abort rolls back the transaction and returns the cause annotated with the rollback outcome
+func (t *deployTransaction) Abort(cause error) error {
+	if err := t.Rollback(); err != nil {
+		return fmt.Errorf("%w; rollback failed, destinations may be inconsistent: %v", cause, err)
+	}
+
+	return fmt.Errorf("%w; deployed files were rolled back", cause)
+}
+
+// mkdirAll creates a directory and its missing parents, recording each one
+func (t *deployTransaction) mkdirAll(dir string) error {
+	if info, err := os.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("failed to create directory %s: a file is in the way", dir)
+		}
+		return nil
+	}
+
+	if err := t.mkdirAll(filepath.Dir(dir)); err != nil {
+		return err
+	}
+
+	return t.mkdir(dir)
+}
+
+// mkdir creates a directory if it does not exist, recording it
+func (t *deployTransaction) mkdir(dir string) error {
+	info, err := os.Stat(dir)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("failed to create directory %s: a file is in the way", dir)
+		}
+		return nil
+	}
+
+	if err := os.Mkdir(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	t.ops = append(t.ops, &deployOp{dir: true, dest: dir})
+	return nil
+}
+
+// stageFile copies a single file or symlink next to its destination
+func (t *deployTransaction) stageFile(src, dest string) error {
+	op := &deployOp{dest: dest, staged: dest + stagedSuffix}
+	if err := os.RemoveAll(op.staged); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, op)
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, op.staged)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(op.staged, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// deployTestDirs returns a repository holding new versions of the dotfiles and a home
+// directory holding the current .zshrc
+func deployTestDirs(t *testing.T) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	repo, home := filepath.Join(root, "repo"), filepath.Join(root, "home")
+	writeFiles(t, repo, ".zshrc", ".vimrc", "nvim/init.lua", "nvim/lua/plugins.lua")
+	if err := os.MkdirAll(home, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".zshrc"), []byte("current"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return repo, home
+}
+
+// assertContent fails unless the file holds content
+func assertContent(t *testing.T, file, content string) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Fatalf("%s contains %q, want %q", file, data, content)
+	}
+}
+
+// assertUntouched fails unless home only holds the current .zshrc
+func assertUntouched(t *testing.T, home string) {
+	t.Helper()
+	assertContent(t, filepath.Join(home, ".zshrc"), "current")
+	entries, err := os.ReadDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Fatalf("home contains %v after rollback, want only .zshrc", names)
+	}
+}
+
+func TestDeployTransactionCommit(t *testing.T) {
+	repo, home := deployTestDirs(t)
+
+	tx := newDeployTransaction()
+	stage := map[string]string{
+		".zshrc": ".zshrc",
+		".vimrc": ".vimrc",
+		"nvim":   ".config/nvim",
+	}
+	for src, dest := range stage {
+		if err := tx.Stage(filepath.Join(repo, src), filepath.Join(home, dest)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is replaced before the commit
+	assertContent(t, filepath.Join(home, ".zshrc"), "current")
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	assertContent(t, filepath.Join(home, ".zshrc"), ".zshrc")
+	assertContent(t, filepath.Join(home, ".vimrc"), ".vimrc")
+	assertContent(t, filepath.Join(home, ".config/nvim/lua/plugins.lua"), "nvim/lua/plugins.lua")
+
+	// No staged copies or backups are left behind
+	err := filepath.WalkDir(home, func(p string, _ os.DirEntry, err error) error {
+		if strings.HasSuffix(p, stagedSuffix) || strings.HasSuffix(p, backupSuffix) {
+			t.Errorf("%s left behind", p)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeployTransactionStageFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string // Source of the failing stage, relative to the repository
+		dest string // Destination of the failing stage, relative to home
+		err  string
+	}{
+		{
+			name: "missing source",
+			src:  "missing",
+			dest: ".config/missing",
+			err:  "no such file or directory",
+		},
+		{
+			name: "file in the way of a directory",
+			src:  ".vimrc",
+			dest: ".zshrc/.vimrc",
+			err:  "a file is in the way",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, home := deployTestDirs(t)
+
+			tx := newDeployTransaction()
+			if err := tx.Stage(filepath.Join(repo, ".zshrc"), filepath.Join(home, ".zshrc")); err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Stage(filepath.Join(repo, "nvim"), filepath.Join(home, ".config/nvim")); err != nil {
+				t.Fatal(err)
+			}
+
+			err := tx.Stage(filepath.Join(repo, test.src), filepath.Join(home, test.dest))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+
+			err = tx.Abort(err)
+			if !strings.Contains(err.Error(), "deployed files were rolled back") {
+				t.Errorf("abort error %q does not report the rollback", err)
+			}
+			assertUntouched(t, home)
+		})
+	}
+}
+
+func TestDeployTransactionCommitFailure(t *testing.T) {
+	repo, home := deployTestDirs(t)
+
+	tx := newDeployTransaction()
+	for src, dest := range map[string]string{".zshrc": ".zshrc", "nvim": ".config/nvim"} {
+		if err := tx.Stage(filepath.Join(repo, src), filepath.Join(home, dest)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Staged last, so that the files before it are already swapped in when it fails
+	if err := tx.Stage(filepath.Join(repo, ".vimrc"), filepath.Join(home, ".vimrc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(home, ".vimrc"+stagedSuffix)); err != nil {
+		t.Fatal(err)
+	}
+
+	err := tx.Commit()
+	if err == nil || !strings.Contains(err.Error(), "failed to replace") {
+		t.Fatalf("got error %v, want a replace error", err)
+	}
+
+	if err := tx.Abort(err); !strings.Contains(err.Error(), "deployed files were rolled back") {
+		t.Errorf("abort error %q does not report the rollback", err)
+	}
+	assertUntouched(t, home)
+}
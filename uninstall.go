@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// RemoveReport is the result of removing a software entry
+type RemoveReport struct {
+	PackageResult
+	Files    []string `json:"files"`              // Deployed files and release binaries that were deleted
+	Restored []string `json:"restored,omitempty"` // Files put back from a backup left by a deploy
+	Skipped  []string `json:"skipped,omitempty"`  // Files kept as they were not deployed by the agent, with the reason
+	LogFile  string   `json:"log_file,omitempty"` // File with the full output of the uninstall command
+}
+
+// removalTarget is a file Remove deletes
+type removalTarget struct {
+	dest   string // Deployed file, directory or release binary
+	source string // File of the repository deployed to dest, empty for release binaries
+	digest string // Digest of dest when it was deployed, for software no longer in the config
+}
+
+// RemovalPlan returns the uninstall command (empty if there is none) and the deployed
+// files of an entry that Remove would delete, if they still match the repository
+func (i *Installer) RemovalPlan(software string) (string, []string, error) {
+	command, targets, err := i.removalPlan(software)
+	if err != nil {
+		return "", nil, err
+	}
+
+	files := make([]string, 0, len(targets))
+	for _, target := range targets {
+		files = append(files, target.dest)
+	}
+	return command, files, nil
+}
+
+// removalPlan returns the uninstall command and the removal targets of an entry.
+// Software that is no longer in the config is looked up in the deploys recorded in StateDir.
+func (i *Installer) removalPlan(software string) (string, []removalTarget, error) {
+	entry := i.config.GetEntry(software)
+	if entry == nil {
+		return i.deployedRemovalPlan(software)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	command, _ := entry.GetUninstallCommand()
+
+	var targets []removalTarget
+	if release, _ := entry.GetRelease(); release != nil && command == "" {
+		for _, bin := range release.Bin {
+			targets = append(targets, removalTarget{dest: filepath.Join(i.Releases.BinDir, path.Base(bin))})
+		}
+	}
+	for _, fileSpec := range entry.Files {
+		dest := filepath.Clean(fileSpec.Destination(homeDir))
+		if dest == filepath.Clean(homeDir) || dest == string(filepath.Separator) {
+			continue // never delete the home directory itself
+		}
+		source := filepath.Join(i.RepoDir, strings.TrimSuffix(fileSpec.Path, ";"))
+		targets = append(targets, removalTarget{dest: dest, source: source})
+	}
+
+	return command, targets, nil
+}
+
+// deployedRemovalPlan returns the uninstall command and the removal targets of software
+// that is no longer in the config, as recorded by the last sync that deployed it
+func (i *Installer) deployedRemovalPlan(software string) (string, []removalTarget, error) {
+	var record DeployRecord
+	if i.StateDir != "" {
+		state, err := LoadAgentState(i.StateDir)
+		if err != nil {
+			return "", nil, err
+		}
+		record = state.Deployed[software]
+	}
+	if record.Files == nil {
+		return "", nil, fmt.Errorf("software %s not found in config or in the deployed files", software)
+	}
+
+	targets := make([]removalTarget, 0, len(record.Files))
+	for dest, digest := range record.Files {
+		targets = append(targets, removalTarget{dest: dest, digest: digest})
+	}
+	slices.SortFunc(targets, func(a, b removalTarget) int {
+		return strings.Compare(a.dest, b.dest)
+	})
+
+	return record.Uninstall, targets, nil
+}
+
+// Remove runs the uninstall command of an entry and deletes its deployed files.
+// Entries installed from a release without an uninstall command get their binaries
+// deleted instead. When the uninstall command fails, the files are kept.
+// A deployed file is only deleted if it is a link into the repository or still has the
+// content of the repository; other files are kept and listed as skipped. A backup left
+// next to a deleted file by an interrupted deploy is put back. The removal is recorded
+// in the history of the agent state when StateDir is set.
+func (i *Installer) Remove(software string) (*RemoveReport, error) {
+	command, targets, err := i.removalPlan(software)
+	if err != nil {
+		return nil, err
+	}
+	entry := i.config.GetEntry(software)
+	if entry == nil {
+		entry = &DotfileEntry{Software: software}
+	}
+
+	executorRun, err := i.Executor.start()
+	if err != nil {
+		return nil, err
+	}
+	defer executorRun.Close()
+
+	run := &installRun{
+		installer: i,
+		executor:  executorRun,
+		total:     1,
+		failed:    make(map[string]bool),
+		report:    &InstallReport{},
+	}
+	report := &RemoveReport{
+		PackageResult: PackageResult{Software: software},
+		Files:         []string{},
+		LogFile:       executorRun.LogFile(),
+	}
+
+	if command != "" {
+		report.PackageResult = run.execute(command, *entry)
+		report.Software = software
+		if report.Status == InstallFailed {
+			i.emit(InstallEvent{Software: software, Status: InstallFailed, Message: report.Reason, Progress: 100})
+			i.recordRemoval(report)
+			return report, nil
+		}
+	}
+
+	var failures []string
+	for _, target := range targets {
+		if _, err := os.Lstat(target.dest); err != nil {
+			continue
+		}
+
+		var reason string
+		switch {
+		case target.source != "":
+			reason = i.deployedFrom(target.source, target.dest)
+		case target.digest != "":
+			reason = unchangedSince(target.digest, target.dest)
+		}
+		if reason != "" {
+			report.Skipped = append(report.Skipped, target.dest+": "+reason)
+			i.emit(InstallEvent{Software: software, Status: InstallOutput, Message: "Kept " + target.dest + ": " + reason})
+			continue
+		}
+
+		if err := os.RemoveAll(target.dest); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		report.Files = append(report.Files, target.dest)
+		i.emit(InstallEvent{Software: software, Status: InstallOutput, Message: "Removed " + target.dest})
+
+		backup := target.dest + backupSuffix
+		if _, err := os.Lstat(backup); err != nil {
+			continue
+		}
+		if err := os.Rename(backup, target.dest); err != nil {
+			failures = append(failures, fmt.Sprintf("failed to restore %s: %v", target.dest, err))
+			continue
+		}
+		report.Restored = append(report.Restored, target.dest)
+		i.emit(InstallEvent{Software: software, Status: InstallOutput, Message: "Restored " + target.dest + " from " + backup})
+	}
+
+	if len(failures) > 0 {
+		report.Status, report.Reason = InstallFailed, strings.Join(failures, "; ")
+		i.emit(InstallEvent{Software: software, Status: InstallFailed, Message: report.Reason, Progress: 100})
+		i.recordRemoval(report)
+		return report, nil
+	}
+
+	report.Status = InstallRemoved
+	i.emit(InstallEvent{Software: software, Status: InstallRemoved, Progress: 100})
+	i.recordRemoval(report)
+	return report, nil
+}
+
+// deployedFrom checks that dest was deployed from source by the agent: a link into the
+// repository, or a copy whose files all match the repository. Returns why it was not,
+// or an empty string if it was.
+func (i *Installer) deployedFrom(source, dest string) string {
+	if i.RepoDir == "" {
+		return "repository unknown"
+	}
+
+	info, err := os.Lstat(dest)
+	if err != nil {
+		return err.Error()
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(dest)
+		if err != nil {
+			return err.Error()
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(dest), link)
+		}
+		if inRepo, _ := filepath.Rel(i.RepoDir, filepath.Clean(link)); inRepo == "." || strings.HasPrefix(inRepo, "..") {
+			return "link outside the repository"
+		}
+		return ""
+	}
+
+	errDiffers := errors.New("differs from the repository")
+	err = filepath.WalkDir(dest, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dest, p)
+		if err != nil {
+			return err
+		}
+		if !sameFile(filepath.Join(source, rel), p) {
+			if rel == "." {
+				return errDiffers
+			}
+			return fmt.Errorf("%s %w", rel, errDiffers)
+		}
+		return nil
+	})
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// unchangedSince checks that dest still has the content it was deployed with.
+// Returns why it has not, or an empty string if it has.
+func unchangedSince(digest, dest string) string {
+	current, err := contentDigest(dest)
+	if err != nil {
+		return err.Error()
+	}
+	if current != digest {
+		return "changed since it was deployed"
+	}
+	return ""
+}
+
+// sameFile reports whether two paths are of the same kind with the same content:
+// directories, links to the same path, or files with equal bytes
+func sameFile(source, dest string) bool {
+	sourceInfo, err := os.Lstat(source)
+	if err != nil {
+		return false
+	}
+	destInfo, err := os.Lstat(dest)
+	if err != nil || sourceInfo.Mode().Type() != destInfo.Mode().Type() {
+		return false
+	}
+
+	switch {
+	case destInfo.IsDir():
+		return true
+	case destInfo.Mode()&os.ModeSymlink != 0:
+		sourceLink, err1 := os.Readlink(source)
+		destLink, err2 := os.Readlink(dest)
+		return err1 == nil && err2 == nil && sourceLink == destLink
+	case sourceInfo.Size() != destInfo.Size():
+		return false
+	}
+
+	sourceContent, err1 := os.ReadFile(source)
+	destContent, err2 := os.ReadFile(dest)
+	return err1 == nil && err2 == nil && bytes.Equal(sourceContent, destContent)
+}
+
+// RemoveSoftware removes software from this machine: it runs the uninstall command,
+// deletes the deployed files and records the removal in the agent state history.
+// The repository is the directory of the config file. Software that is no longer in the
+// config is removed as recorded by the last sync that deployed it.
+func RemoveSoftware(configPath string, software string, interactive bool, executor Executor, stateDir string) error {
+	config, err := ParseEnhancedConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	repoDir, err := filepath.Abs(filepath.Dir(configPath))
+	if err != nil {
+		return err
+	}
+
+	installer := NewInstaller(config, printRemoveEvents)
+	installer.Executor = executor
+	installer.RepoDir = repoDir
+	installer.StateDir = stateDir
+	command, files, err := installer.RemovalPlan(software)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Removing %s:\n\n", software)
+	if config.GetEntry(software) == nil {
+		fmt.Printf("  (not in %s, using the files deployed by the last sync)\n", configPath)
+	}
+	if command != "" {
+		fmt.Printf("  run: %s\n", command)
+	}
+	for _, file := range files {
+		fmt.Printf("  delete: %s\n", file)
+	}
+	if len(files) > 0 {
+		fmt.Println("\nFiles that were not deployed from", repoDir, "or were changed since are kept.")
+	}
+	fmt.Println()
+
+	if interactive {
+		reader := bufio.NewReader(os.Stdin)
+		fmt.Printf("Do you want to remove %s? (y/n): ", software)
+		response, _ := reader.ReadString('\n')
+		response = strings.TrimSpace(strings.ToLower(response))
+
+		if response != "y" && response != "yes" {
+			fmt.Println("Removal cancelled")
+			return nil
+		}
+	}
+
+	report, err := installer.Remove(software)
+	if err != nil {
+		return err
+	}
+
+	for _, skipped := range report.Skipped {
+		fmt.Printf("  kept: %s\n", skipped)
+	}
+
+	if report.Status != InstallRemoved {
+		return fmt.Errorf("failed to remove %s: %s", software, report.Reason)
+	}
+
+	if report.LogFile != "" {
+		fmt.Printf("Full output: %s\n", report.LogFile)
+	}
+	return nil
+}
+
+// printRemoveEvents prints the progress of a removal
+func printRemoveEvents(event InstallEvent) {
+	switch event.Status {
+	case InstallStarted:
+		fmt.Printf("Running %s\n", event.Message)
+	case InstallOutput:
+		fmt.Println(event.Message)
+	case InstallRemoved:
+		fmt.Printf("  ✓ Successfully removed %s\n\n", event.Software)
+	case InstallFailed:
+		fmt.Printf("  ✗ Failed to remove %s: %s\n\n", event.Software, event.Message)
+	}
+}
+
+// recordRemoval adds a removal to the history of the agent state in StateDir. Removed
+// software is forgotten, so it is installed again by `auto_install: new` if it comes back.
+func (i *Installer) recordRemoval(report *RemoveReport) {
+	if i.StateDir == "" {
+		return
+	}
+
+	if err := saveRemoval(i.StateDir, report); err != nil {
+		Error("Failed to record removal:", err.Error())
+	}
+}
+
+// saveRemoval adds a removal to the history of the agent state in a directory
+func saveRemoval(stateDir string, report *RemoveReport) error {
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return err
+	}
+
+	state, err := LoadAgentState(stateDir)
+	if err != nil {
+		return err
+	}
+
+	success := report.Status == InstallRemoved
+	if success {
+		state.KnownSoftware = slices.DeleteFunc(state.KnownSoftware, func(software string) bool {
+			return software == report.Software
+		})
+		delete(state.Deployed, report.Software)
+	}
+	state.Record(HistoryEntry{
+		Action:   "remove",
+		Software: report.Software,
+		Success:  success,
+		Files:    report.Files,
+		Skipped:  report.Skipped,
+		Message:  report.Reason,
+	})
+
+	return state.Save(stateDir)
+}
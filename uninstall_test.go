@@ -0,0 +1,287 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// removeTestConfig is an entry deploying a file and a directory from the repository
+const removeTestConfig = `dotfiles:
+  - software: tool
+    files:
+      - path: .toolrc
+        target: home
+      - path: tool;
+        target: home/.config
+`
+
+// removeTestInstaller returns an installer for removeTestConfig with its repository,
+// home and state directories
+func removeTestInstaller(t *testing.T) (*Installer, string, string) {
+	t.Helper()
+	root := t.TempDir()
+	repoDir, homeDir, stateDir := filepath.Join(root, "repo"), filepath.Join(root, "user"), filepath.Join(root, "state")
+	t.Setenv("HOME", homeDir)
+
+	writeFiles(t, repoDir, ".toolrc", "tool/config", "tool/themes/dark")
+	if err := os.WriteFile(filepath.Join(repoDir, DotfileConfigName), []byte(removeTestConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := ParseEnhancedConfig(filepath.Join(repoDir, DotfileConfigName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installer := NewInstaller(config)
+	installer.RepoDir = repoDir
+	installer.StateDir = stateDir
+	return installer, repoDir, homeDir
+}
+
+func TestRemoveDeletesDeployedFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		deploy   func(t *testing.T, repoDir, homeDir string)
+		removed  []string // Paths relative to home that are deleted
+		skipped  []string // Paths relative to home that are kept
+		restored []string // Paths relative to home put back from a backup
+	}{
+		{
+			name: "copies",
+			deploy: func(t *testing.T, repoDir, homeDir string) {
+				copyTree(t, filepath.Join(repoDir, "tool"), filepath.Join(homeDir, ".config/tool"))
+				copyTree(t, filepath.Join(repoDir, ".toolrc"), filepath.Join(homeDir, ".toolrc"))
+			},
+			removed: []string{".toolrc", ".config/tool"},
+		},
+		{
+			name: "links into the repository",
+			deploy: func(t *testing.T, repoDir, homeDir string) {
+				symlink(t, filepath.Join(repoDir, ".toolrc"), filepath.Join(homeDir, ".toolrc"))
+				symlink(t, filepath.Join(repoDir, "tool"), filepath.Join(homeDir, ".config/tool"))
+			},
+			removed: []string{".toolrc", ".config/tool"},
+		},
+		{
+			name: "changed file and foreign link",
+			deploy: func(t *testing.T, repoDir, homeDir string) {
+				if err := os.WriteFile(filepath.Join(homeDir, ".toolrc"), []byte("edited"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				symlink(t, t.TempDir(), filepath.Join(homeDir, ".config/tool"))
+			},
+			skipped: []string{".toolrc", ".config/tool"},
+		},
+		{
+			name: "directory with a file not in the repository",
+			deploy: func(t *testing.T, repoDir, homeDir string) {
+				copyTree(t, filepath.Join(repoDir, "tool"), filepath.Join(homeDir, ".config/tool"))
+				writeFiles(t, homeDir, ".config/tool/cache")
+			},
+			skipped: []string{".config/tool"},
+		},
+		{
+			name: "backup restored",
+			deploy: func(t *testing.T, repoDir, homeDir string) {
+				copyTree(t, filepath.Join(repoDir, ".toolrc"), filepath.Join(homeDir, ".toolrc"))
+				if err := os.WriteFile(filepath.Join(homeDir, ".toolrc"+backupSuffix), []byte("before"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			removed:  []string{".toolrc"},
+			restored: []string{".toolrc"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			installer, repoDir, homeDir := removeTestInstaller(t)
+			if err := os.MkdirAll(filepath.Join(homeDir, ".config"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			test.deploy(t, repoDir, homeDir)
+
+			report, err := installer.Remove("tool")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != InstallRemoved {
+				t.Fatalf("status %s: %s", report.Status, report.Reason)
+			}
+
+			for _, file := range test.removed {
+				dest := filepath.Join(homeDir, file)
+				if !slices.Contains(report.Files, dest) {
+					t.Errorf("%s not reported as removed: %v", file, report.Files)
+				}
+				if _, err := os.Lstat(dest); err == nil && !slices.Contains(test.restored, file) {
+					t.Errorf("%s still exists", file)
+				}
+			}
+			for _, file := range test.skipped {
+				dest := filepath.Join(homeDir, file)
+				if !slices.ContainsFunc(report.Skipped, func(skipped string) bool { return strings.HasPrefix(skipped, dest+": ") }) {
+					t.Errorf("%s not reported as skipped: %v", file, report.Skipped)
+				}
+				if _, err := os.Lstat(dest); err != nil {
+					t.Errorf("%s was deleted", file)
+				}
+			}
+			for _, file := range test.restored {
+				data, err := os.ReadFile(filepath.Join(homeDir, file))
+				if err != nil || string(data) != "before" {
+					t.Errorf("%s not restored: %q %v", file, data, err)
+				}
+			}
+			if len(report.Skipped) != len(test.skipped) || len(report.Restored) != len(test.restored) {
+				t.Errorf("skipped %v, restored %v", report.Skipped, report.Restored)
+			}
+
+			// the repository is left alone, even through links
+			if _, err := os.Stat(filepath.Join(repoDir, "tool/themes/dark")); err != nil {
+				t.Errorf("repository file deleted: %v", err)
+			}
+		})
+	}
+}
+
+func TestRemoveRecordsHistory(t *testing.T) {
+	installer, _, _ := removeTestInstaller(t)
+	if err := os.MkdirAll(installer.StateDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&AgentState{KnownSoftware: []string{"tool", "other"}}).Save(installer.StateDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := installer.Remove("tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadAgentState(installer.StateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(state.KnownSoftware, []string{"other"}) {
+		t.Errorf("known software %v, want [other]", state.KnownSoftware)
+	}
+	if len(state.History) != 1 || state.History[0].Action != "remove" || state.History[0].Software != "tool" || !state.History[0].Success {
+		t.Errorf("history %+v", state.History)
+	}
+}
+
+func TestRemoveSoftwareDroppedFromConfig(t *testing.T) {
+	installer, repoDir, homeDir := removeTestInstaller(t)
+	if err := os.MkdirAll(installer.StateDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	copyTree(t, filepath.Join(repoDir, "tool"), filepath.Join(homeDir, ".config/tool"))
+	copyTree(t, filepath.Join(repoDir, ".toolrc"), filepath.Join(homeDir, ".toolrc"))
+
+	// A sync deploys the entry, which is then dropped from the config and the repository
+	configPathsInfo, err := installer.config.GetConfigPaths(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saveDeploys(installer.StateDir, installer.config, configPathsInfo); err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadAgentState(installer.StateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Deployed["tool"] = DeployRecord{Uninstall: `touch "$HOME/uninstalled"`, Files: state.Deployed["tool"].Files}
+	if err := state.Save(installer.StateDir); err != nil {
+		t.Fatal(err)
+	}
+
+	installer.config = &EnhancedConfig{}
+	if err := os.RemoveAll(repoDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(homeDir, ".config/tool/config"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	command, files, err := installer.RemovalPlan("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(homeDir, ".config/tool"), filepath.Join(homeDir, ".toolrc")}
+	if command == "" || !slices.Equal(files, want) {
+		t.Fatalf("plan runs %q and deletes %v, want %v", command, files, want)
+	}
+
+	report, err := installer.Remove("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != InstallRemoved {
+		t.Fatalf("status %s: %s", report.Status, report.Reason)
+	}
+	if _, err := os.Stat(filepath.Join(homeDir, "uninstalled")); err != nil {
+		t.Error("uninstall command not run")
+	}
+
+	// The unchanged file is deleted, the edited directory is kept
+	if _, err := os.Lstat(filepath.Join(homeDir, ".toolrc")); err == nil {
+		t.Error(".toolrc still exists")
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0] != filepath.Join(homeDir, ".config/tool")+": changed since it was deployed" {
+		t.Errorf("skipped %v", report.Skipped)
+	}
+
+	// The record is forgotten with the removal
+	state, err = LoadAgentState(installer.StateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.Deployed["tool"]; ok {
+		t.Error("deploy record kept after the removal")
+	}
+	if _, _, err := installer.RemovalPlan("tool"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("got error %v after the removal, want not found", err)
+	}
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// copyTree copies a file or a directory like an enhanced deploy does
+func copyTree(t *testing.T, source, dest string) {
+	t.Helper()
+	err := filepath.Walk(source, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
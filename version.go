@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// defaultVersionPattern finds the first dotted version number in a version command output
+var defaultVersionPattern = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+
+// VersionRequirement describes how to read the installed version of software and which versions are supported.
+// `version: {command: nvim --version, pattern: "NVIM v(\\S+)", constraint: ">=0.9"}`
+type VersionRequirement struct {
+	Command    string `yaml:"command"`              // Shell command printing the version
+	Pattern    string `yaml:"pattern,omitempty"`    // Regular expression whose first group (or match) is the version
+	Constraint string `yaml:"constraint"`           // Semver constraint, e.g. ">=0.9" or "^3.2"
+	SkipFiles  bool   `yaml:"skip_files,omitempty"` // Do not deploy the files when the installed version is not supported
+}
+
+// VersionStatus is the result of checking the installed version of a software entry
+type VersionStatus struct {
+	Software   string `json:"software"`
+	Version    string `json:"version,omitempty"` // Installed version, empty if it could not be detected
+	Constraint string `json:"constraint"`
+	Satisfied  bool   `json:"satisfied"`
+	Error      string `json:"error,omitempty"` // Why the version could not be checked
+}
+
+// Detect runs the version command and returns the installed version
+func (v *VersionRequirement) Detect() (*semver.Version, error) {
+	output, err := probe(v.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := defaultVersionPattern
+	if v.Pattern != "" {
+		if pattern, err = regexp.Compile(v.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid version pattern %q: %w", v.Pattern, err)
+		}
+	}
+
+	match := pattern.FindSubmatch(output)
+	if match == nil {
+		return nil, fmt.Errorf("no version found in the output of %q", v.Command)
+	}
+	raw := string(match[0])
+	if len(match) > 1 {
+		raw = string(match[1])
+	}
+
+	return parseVersion(raw)
+}
+
+// Check detects the installed version and compares it with the constraint.
+// Pre-release versions (0.10.0-dev) are compared as their release.
+func (v *VersionRequirement) Check() (bool, *semver.Version, error) {
+	constraint, err := semver.NewConstraint(v.Constraint)
+	if err != nil {
+		return false, nil, fmt.Errorf("invalid version constraint %q: %w", v.Constraint, err)
+	}
+
+	version, err := v.Detect()
+	if err != nil {
+		return false, nil, err
+	}
+
+	release, _ := version.SetPrerelease("")
+	return constraint.Check(&release), version, nil
+}
+
+// parseVersion parses a version leniently: suffixes semver does not accept,
+// like the letter of tmux 3.3a, are dropped
+func parseVersion(raw string) (*semver.Version, error) {
+	raw = strings.TrimSpace(raw)
+	if version, err := semver.NewVersion(raw); err == nil {
+		return version, nil
+	}
+
+	if prefix := defaultVersionPattern.FindString(raw); prefix != "" {
+		return semver.NewVersion(prefix)
+	}
+
+	return nil, fmt.Errorf("invalid version %q", raw)
+}
+
+// CheckVersion checks the installed version of an entry against its version constraint.
+// It returns nil for entries without a version requirement.
+func (d *DotfileEntry) CheckVersion() *VersionStatus {
+	if d.Version == nil {
+		return nil
+	}
+
+	status := &VersionStatus{Software: d.Software, Constraint: d.Version.Constraint}
+	satisfied, version, err := d.Version.Check()
+	if version != nil {
+		status.Version = version.Original()
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.Satisfied = satisfied
+	return status
+}
+
+// CheckVersions checks every entry with a version requirement
+func (c *EnhancedConfig) CheckVersions() []VersionStatus {
+	statuses := []VersionStatus{}
+	for _, entry := range c.Dotfiles {
+		if status := entry.CheckVersion(); status != nil {
+			statuses = append(statuses, *status)
+		}
+	}
+	return statuses
+}